@@ -1,13 +1,17 @@
 package api
 
 import (
+	"awesomeProject/models"
 	"awesomeProject/services"
 	"awesomeProject/types"
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
+	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -95,11 +99,13 @@ func (controller *ChatController) SendMessage(w http.ResponseWriter, r *http.Req
 	}
 	defer r.Body.Close()
 	data := struct {
-		Content string
+		Content   string
+		ReplyToId int64
+		UploadIds []string
 	}{}
 	json.NewDecoder(r.Body).Decode(&data)
 	res, statusErr := controller.MessageService.
-		SendMessage(r.Context(), userId, chatId, data.Content)
+		SendMessage(r.Context(), userId, chatId, data.Content, data.ReplyToId, data.UploadIds)
 	if statusErr != nil {
 		http.Error(w, statusErr.Error(), statusErr.Status)
 		return
@@ -114,12 +120,12 @@ func (controller *ChatController) GetLatestChats(w http.ResponseWriter, r *http.
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	messages, statErr := controller.MessageService.GetLatestChats(r.Context(), userId)
+	chats, statErr := controller.MessageService.GetLatestChats(r.Context(), userId, r.URL.Query().Get("archived") == "true")
 	if statErr != nil {
 		http.Error(w, statErr.Error(), statErr.Status)
 		return
 	}
-	json.NewEncoder(w).Encode(messages)
+	json.NewEncoder(w).Encode(chats)
 }
 func (controller *ChatController) UpdateMessage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
@@ -182,3 +188,335 @@ func parseInt64WithDefault(text string, def int64) int64 {
 	}
 	return num
 }
+
+func (controller *ChatController) MarkRead(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect chatId"})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	data := struct {
+		MessageId int64
+	}{}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect request body"})
+		return
+	}
+	statErr := controller.MessageService.MarkRead(r.Context(), userId, chatId, data.MessageId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ChatController) GetMessageReaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect messageId"})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	readers, statErr := controller.MessageService.GetMessageReaders(r.Context(), userId, messageId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(readers)
+}
+func (controller *ChatController) GetThread(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect messageId"})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	thread, statErr := controller.MessageService.GetThread(r.Context(), messageId, userId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(thread)
+}
+func (controller *ChatController) AddReaction(w http.ResponseWriter, r *http.Request) {
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect messageId", http.StatusBadRequest)
+		return
+	}
+	data := models.ReactionRequest{}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validator.New().Struct(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.MessageService.AddReaction(r.Context(), userId, messageId, data.Emoji); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ChatController) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect messageId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	statErr := controller.MessageService.RemoveReaction(r.Context(), userId, messageId, r.PathValue("emoji"))
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ChatController) GetMessageHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect messageId"})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	revisions, statErr := controller.MessageService.GetMessageHistory(r.Context(), userId, messageId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(revisions)
+}
+func (controller *ChatController) HideMessage(w http.ResponseWriter, r *http.Request) {
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect messageId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.MessageService.HideMessage(r.Context(), messageId, userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ChatController) ForwardMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect chatId"})
+		return
+	}
+	data := models.ForwardMessagesRequest{}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err = validator.New().Struct(data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	messages, statErr := controller.MessageService.ForwardMessages(r.Context(), userId, chatId, data.MessageIds)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(messages)
+}
+func (controller *ChatController) PinMessage(w http.ResponseWriter, r *http.Request) {
+	controller.changePin(w, r, true)
+}
+func (controller *ChatController) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	controller.changePin(w, r, false)
+}
+func (controller *ChatController) changePin(w http.ResponseWriter, r *http.Request, pin bool) {
+	messageId, err := strconv.ParseInt(r.PathValue("messageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect messageId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var statErr *types.StatusError
+	if pin {
+		statErr = controller.MessageService.PinMessage(r.Context(), userId, messageId)
+	} else {
+		statErr = controller.MessageService.UnpinMessage(r.Context(), userId, messageId)
+	}
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ChatController) GetPinnedMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect chatId"})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	messages, statErr := controller.MessageService.GetPinnedMessages(r.Context(), chatId, userId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(messages)
+}
+
+// SendAttachments receives multipart form with one or more "file" parts, optional "content" caption and "replyToId"
+func (controller *ChatController) SendAttachments(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxAttachments*services.MaxAttachmentSize+1<<20)
+	if err = r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	var replyToId int64
+	if value := r.FormValue("replyToId"); value != "" {
+		if replyToId, err = strconv.ParseInt(value, 10, 64); err != nil {
+			http.Error(w, "Incorrect replyToId", http.StatusBadRequest)
+			return
+		}
+	}
+	headers := r.MultipartForm.File["file"]
+	uploads := make([]services.Upload, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		uploads = append(uploads, services.Upload{FileName: header.Filename, Size: header.Size, File: file})
+	}
+	message, statErr := controller.MessageService.SendAttachments(r.Context(), userId, chatId, r.FormValue("content"), replyToId, uploads)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+func (controller *ChatController) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	controller.serveAttachment(w, r, false)
+}
+func (controller *ChatController) GetAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	controller.serveAttachment(w, r, true)
+}
+func (controller *ChatController) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	attachmentId, err := strconv.ParseInt(r.PathValue("attachmentId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect attachmentId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	file, statErr := controller.MessageService.OpenAttachment(r.Context(), userId, attachmentId, thumbnail)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	serveFile(w, r, file)
+}
+
+// bodyErrorStatus is 413 when reading the request body failed on http.MaxBytesReader limit, 400 otherwise
+func bodyErrorStatus(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// serveFile redirects to presigned link of the file or sends its content
+func serveFile(w http.ResponseWriter, r *http.Request, file *services.AttachmentFile) {
+	if file.URL != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, file.URL, http.StatusFound)
+		return
+	}
+	defer file.Body.Close()
+	w.Header().Set("Content-Type", file.ContentType)
+	if file.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(file.Disposition, map[string]string{"filename": file.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, file.Body); err != nil {
+		log.Printf("send file %s: %v", file.FileName, err)
+	}
+}
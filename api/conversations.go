@@ -0,0 +1,427 @@
+package api
+
+import (
+	"awesomeProject/models"
+	"awesomeProject/services"
+	"encoding/json"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type ConversationController struct {
+	ConversationService *services.ConversationService
+}
+
+func (controller *ConversationController) GetMembers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Incorrect chatId"})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	members, statErr := controller.ConversationService.GetMembers(r.Context(), chatId, userId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(members)
+}
+
+func (controller *ConversationController) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	data := models.CreateGroupRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err := validator.New().Struct(data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	chat, statErr := controller.ConversationService.CreateGroup(r.Context(), userId, data.Name, data.MemberIds, data.IsChannel)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(chat)
+}
+
+func (controller *ConversationController) AddMembers(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	data := models.AddMembersRequest{}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validator.New().Struct(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.ConversationService.AddMembers(r.Context(), chatId, userId, data.UserIds); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	chatId, memberId, userId, ok := parseMemberRequest(w, r)
+	if !ok {
+		return
+	}
+	if statErr := controller.ConversationService.RemoveMember(r.Context(), chatId, userId, memberId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) SetRole(w http.ResponseWriter, r *http.Request) {
+	chatId, memberId, userId, ok := parseMemberRequest(w, r)
+	if !ok {
+		return
+	}
+	data := struct {
+		Role string
+	}{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if statErr := controller.ConversationService.SetRole(r.Context(), chatId, userId, memberId, data.Role); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	data := struct {
+		UserId int64
+	}{}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.ConversationService.TransferOwnership(r.Context(), chatId, userId, data.UserId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) Leave(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.ConversationService.Leave(r.Context(), chatId, userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) Hide(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.ConversationService.Hide(r.Context(), chatId, userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) Delete(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.ConversationService.Delete(r.Context(), chatId, userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseMemberRequest reads {chatId} and {userId} path values and caller id, writes error response on failure
+func parseMemberRequest(w http.ResponseWriter, r *http.Request) (chatId, memberId, userId int64, ok bool) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+	memberId, err = strconv.ParseInt(r.PathValue("userId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect userId", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+	userId, err = getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return 0, 0, 0, false
+	}
+	return chatId, memberId, userId, true
+}
+
+func (controller *ConversationController) UpdateChat(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	data := models.UpdateChatRequest{}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validator.New().Struct(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	chat, statErr := controller.ConversationService.UpdateChat(r.Context(), chatId, userId, data)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(chat)
+}
+
+// UploadAvatar expects multipart form with image in "avatar" field
+func (controller *ConversationController) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxAvatarSize+1024)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	if len(data) == 0 || len(data) > services.MaxAvatarSize {
+		http.Error(w, "avatar must be not empty and not bigger than 5MB", http.StatusBadRequest)
+		return
+	}
+	chat, statErr := controller.ConversationService.SetAvatar(r.Context(), chatId, userId, data)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(chat)
+}
+
+func (controller *ConversationController) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if _, statErr := controller.ConversationService.SetAvatar(r.Context(), chatId, userId, nil); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *ConversationController) GetAvatar(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	file, statErr := controller.ConversationService.OpenAvatar(r.Context(), chatId, userId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	serveFile(w, r, file)
+}
+
+// parseChatRequest reads {chatId} path value and caller id, writes error response on failure
+func parseChatRequest(w http.ResponseWriter, r *http.Request) (chatId, userId int64, ok bool) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userId, err = getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	return chatId, userId, true
+}
+func (controller *ConversationController) Mute(w http.ResponseWriter, r *http.Request) {
+	chatId, userId, ok := parseChatRequest(w, r)
+	if !ok {
+		return
+	}
+	data := models.MuteChatRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validator.New().Struct(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	duration := time.Duration(data.DurationSeconds) * time.Second
+	if statErr := controller.ConversationService.Mute(r.Context(), chatId, userId, duration); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ConversationController) Unmute(w http.ResponseWriter, r *http.Request) {
+	chatId, userId, ok := parseChatRequest(w, r)
+	if !ok {
+		return
+	}
+	if statErr := controller.ConversationService.Unmute(r.Context(), chatId, userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ConversationController) Archive(w http.ResponseWriter, r *http.Request) {
+	controller.setArchived(w, r, true)
+}
+func (controller *ConversationController) Unarchive(w http.ResponseWriter, r *http.Request) {
+	controller.setArchived(w, r, false)
+}
+func (controller *ConversationController) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	chatId, userId, ok := parseChatRequest(w, r)
+	if !ok {
+		return
+	}
+	if statErr := controller.ConversationService.SetArchived(r.Context(), chatId, userId, archived); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ConversationController) Pin(w http.ResponseWriter, r *http.Request) {
+	chatId, userId, ok := parseChatRequest(w, r)
+	if !ok {
+		return
+	}
+	data := models.PinChatRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validator.New().Struct(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if statErr := controller.ConversationService.Pin(r.Context(), chatId, userId, data.Order); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+func (controller *ConversationController) Unpin(w http.ResponseWriter, r *http.Request) {
+	chatId, userId, ok := parseChatRequest(w, r)
+	if !ok {
+		return
+	}
+	if statErr := controller.ConversationService.Unpin(r.Context(), chatId, userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
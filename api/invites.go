@@ -0,0 +1,91 @@
+package api
+
+import (
+	"awesomeProject/models"
+	"awesomeProject/services"
+	"encoding/json"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"strconv"
+)
+
+type InviteController struct {
+	InviteService *services.InviteService
+}
+
+func (controller *InviteController) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	data := models.CreateInviteRequest{}
+	defer r.Body.Close()
+	json.NewDecoder(r.Body).Decode(&data)
+	if err = validator.New().Struct(data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	invite, statErr := controller.InviteService.CreateInvite(r.Context(), chatId, userId, data)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+func (controller *InviteController) GetInvites(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	invites, statErr := controller.InviteService.GetInvites(r.Context(), chatId, userId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(invites)
+}
+
+func (controller *InviteController) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.InviteService.RevokeInvite(r.Context(), r.PathValue("code"), userId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *InviteController) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	chatId, statErr := controller.InviteService.AcceptInvite(r.Context(), r.PathValue("code"), userId)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "chatId": chatId})
+}
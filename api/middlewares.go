@@ -1,6 +1,7 @@
 package api
 
 import (
+	"awesomeProject/services"
 	"awesomeProject/types"
 	"context"
 	"encoding/json"
@@ -28,6 +29,33 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// TokenFromQuery lets clients that can't set headers (browser websockets)
+// pass the access token as ?token= query param
+func TokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PresenceMiddleware marks user with a valid bearer token as active, it never rejects requests
+func PresenceMiddleware(presence *services.PresenceService, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokString, exists := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if exists {
+			if token, err := verifyToken(tokString); err == nil {
+				ctx := context.WithValue(r.Context(), types.UserContext, token)
+				if userId, err := getUserIdFromJwtToken(ctx); err == nil {
+					presence.Touch(r.Context(), userId)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 func verifyToken(tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return types.SecretKey, nil
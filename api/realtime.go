@@ -0,0 +1,243 @@
+package api
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/realtime"
+	"awesomeProject/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// auth goes through the bearer token, not cookies, so any origin is fine
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type RealtimeController struct {
+	Hub             *realtime.Hub
+	Queries         *db.Queries
+	TypingService   *services.TypingService
+	PresenceService *services.PresenceService
+}
+
+// clientMessage is what websocket clients may send to the server
+type clientMessage struct {
+	Type           string `json:"type"`
+	ConversationID int64  `json:"conversationId"`
+}
+
+func (controller *RealtimeController) ServeWs(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	chatIds, err := controller.Queries.GetUserConversationIds(r.Context(), userId)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("websocket upgrade: %v", err)
+		return
+	}
+	client := realtime.NewClient(userId)
+	missed := controller.Hub.Resume(client, chatIds, parseInt64WithDefault(r.URL.Query().Get("lastEventId"), 0))
+	controller.PresenceService.Connected(r.Context(), userId)
+	go writePump(conn, client, missed)
+	controller.readPump(r.Context(), conn, client)
+}
+
+// ServeEvents is Server-Sent Events fallback for clients which can't use websockets.
+// Reconnecting clients get missed events replayed by Last-Event-ID header.
+func (controller *RealtimeController) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	chatIds, err := controller.Queries.GetUserConversationIds(r.Context(), userId)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+	client := realtime.NewClient(userId)
+	missed := controller.Hub.Resume(client, chatIds, parseInt64WithDefault(lastEventId, 0))
+	controller.PresenceService.Connected(r.Context(), userId)
+	defer controller.disconnect(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range missed {
+		if err = writeSseEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-client.Send:
+			if !ok {
+				return
+			}
+			if err = writeSseEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSseEvent(w http.ResponseWriter, event realtime.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ID != 0 {
+		if _, err = fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// readPump handles client messages, keeps connection alive and unregisters the client when it goes away
+func (controller *RealtimeController) readPump(ctx context.Context, conn *websocket.Conn, client *realtime.Client) {
+	defer func() {
+		controller.disconnect(client)
+		conn.Close()
+	}()
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		var msg clientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				continue
+			}
+			return
+		}
+		switch msg.Type {
+		case realtime.TypingStarted:
+			if statErr := controller.TypingService.StartTyping(ctx, client.UserID, msg.ConversationID); statErr != nil {
+				log.Printf("typing in chat %d: %v", msg.ConversationID, statErr)
+			}
+		case realtime.TypingStopped:
+			controller.TypingService.StopTyping(client.UserID, msg.ConversationID)
+		}
+	}
+}
+
+func (controller *RealtimeController) StartTyping(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.TypingService.StartTyping(r.Context(), userId, chatId); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *RealtimeController) StopTyping(w http.ResponseWriter, r *http.Request) {
+	chatId, err := strconv.ParseInt(r.PathValue("chatId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Incorrect chatId", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	controller.TypingService.StopTyping(userId, chatId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// disconnect runs on closed connection, so request context can't be used
+func (controller *RealtimeController) disconnect(client *realtime.Client) {
+	controller.Hub.Unregister(client)
+	controller.PresenceService.Disconnected(context.Background(), client.UserID)
+}
+
+func writePump(conn *websocket.Conn, client *realtime.Client, missed []realtime.Event) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+	for _, event := range missed {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case event, ok := <-client.Send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
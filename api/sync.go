@@ -0,0 +1,35 @@
+package api
+
+import (
+	"awesomeProject/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+type SyncController struct {
+	SyncService *services.SyncService
+}
+
+// Sync returns page of changes after ?since= cursor, clients repeat it with returned cursor while hasMore is true
+func (controller *SyncController) Sync(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expected since query param"})
+		return
+	}
+	limit := parseInt64WithDefault(r.URL.Query().Get("limit"), services.DefaultSyncPageSize)
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	page, statErr := controller.SyncService.GetChanges(r.Context(), userId, since, limit)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(page)
+}
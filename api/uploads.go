@@ -0,0 +1,103 @@
+package api
+
+import (
+	"awesomeProject/models"
+	"awesomeProject/services"
+	"encoding/json"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"strconv"
+)
+
+type UploadController struct {
+	UploadService *services.UploadService
+}
+
+// setUploadHeaders reports upload state in headers like tus does, so HEAD requests are enough to resume
+func setUploadHeaders(w http.ResponseWriter, upload *models.UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func (controller *UploadController) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	data := models.CreateUploadRequest{}
+	defer r.Body.Close()
+	json.NewDecoder(r.Body).Decode(&data)
+	if err := validator.New().Struct(data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	upload, statErr := controller.UploadService.CreateUpload(r.Context(), userId, data)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	setUploadHeaders(w, upload)
+	w.Header().Set("Location", upload.URL)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(upload)
+}
+
+func (controller *UploadController) GetUpload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	upload, statErr := controller.UploadService.GetUpload(r.Context(), userId, r.PathValue("uploadId"))
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	setUploadHeaders(w, upload)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(upload)
+}
+
+// AppendChunk expects Upload-Offset header with the number of bytes the server already has and the chunk as body
+func (controller *UploadController) AppendChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Incorrect Upload-Offset", http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	defer r.Body.Close()
+	upload, statErr := controller.UploadService.AppendChunk(r.Context(), userId, r.PathValue("uploadId"), offset, r.Body)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (controller *UploadController) CancelUpload(w http.ResponseWriter, r *http.Request) {
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.UploadService.CancelUpload(r.Context(), userId, r.PathValue("uploadId")); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"awesomeProject/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxPresenceIds limits the size of bulk presence request
+const maxPresenceIds = 100
+
+type UserController struct {
+	PresenceService *services.PresenceService
+}
+
+// GetPresence returns presence of users listed in ?ids=1,2,3
+func (controller *UserController) GetPresence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var ids []int64
+	for _, part := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "ids must be comma separated list of user ids"})
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 || len(ids) > maxPresenceIds {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "expected from 1 to 100 ids"})
+		return
+	}
+	presence, statErr := controller.PresenceService.GetPresence(r.Context(), ids)
+	if statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	json.NewEncoder(w).Encode(presence)
+}
+
+func (controller *UserController) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		HideLastSeen bool
+	}{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userId, err := getUserIdFromJwtToken(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if statErr := controller.PresenceService.SetHideLastSeen(r.Context(), userId, data.HideLastSeen); statErr != nil {
+		http.Error(w, statErr.Error(), statErr.Status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+// Command migrate-storage moves uploaded files between storage drivers, for example from local disk to S3:
+//
+//	go run ./cmd/migrate-storage -from local -to s3
+//
+// Drivers are configured by the same environment variables as the server. Files are copied, so the server
+// can keep running on the old storage until STORAGE_DRIVER is switched, -delete removes copied files from source.
+package main
+
+import (
+	"awesomeProject/storage"
+	"context"
+	"flag"
+	"github.com/joho/godotenv"
+	"log"
+)
+
+func main() {
+	from := flag.String("from", "local", "storage driver to read files from")
+	to := flag.String("to", "s3", "storage driver to write files to")
+	deleteSource := flag.Bool("delete", false, "delete files from source storage after they are copied")
+	flag.Parse()
+	if *from == *to {
+		log.Fatal("source and destination storages are the same")
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Printf("load .env: %v", err)
+	}
+	ctx := context.Background()
+	src, err := storage.FromEnv(ctx, *from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dst, err := storage.FromEnv(ctx, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	copied, err := storage.Migrate(ctx, src, dst, *deleteSource)
+	log.Printf("copied %d files from %s to %s", copied, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -9,27 +9,117 @@ import (
 	"time"
 )
 
+type Attachment struct {
+	ID              int64
+	MessageID       int64
+	StorageKey      string
+	FileName        string
+	ContentType     string
+	Size            int64
+	CreatedAt       time.Time
+	Width           sql.NullInt64
+	Height          sql.NullInt64
+	ThumbnailKey    sql.NullString
+	ThumbnailStatus string
+}
+
+type Change struct {
+	ID             int64
+	ConversationID int64
+	Kind           string
+	MessageID      sql.NullInt64
+	UserID         sql.NullInt64
+	CreatedAt      time.Time
+}
+
 type Conversation struct {
-	ID        int64
-	IsGroup   sql.NullInt64
-	Name      sql.NullString
-	CreatedAt sql.NullTime
+	ID          int64
+	IsGroup     sql.NullInt64
+	Name        sql.NullString
+	CreatedAt   sql.NullTime
+	Description sql.NullString
+	AvatarPath  sql.NullString
+	IsChannel   int64
 }
 
 type ConversationParticipant struct {
+	ID                int64
+	UserID            int64
+	ConversationID    int64
+	JoinedAt          sql.NullTime
+	Role              string
+	LastReadMessageID int64
+	Hidden            int64
+	MutedUntil        sql.NullTime
+	Archived          int64
+	PinnedOrder       sql.NullInt64
+}
+
+type HiddenMessage struct {
+	MessageID int64
+	UserID    int64
+}
+
+type Invite struct {
 	ID             int64
-	UserID         int64
+	Code           string
 	ConversationID int64
-	JoinedAt       sql.NullTime
-	IsAdmin        sql.NullInt64
+	CreatedBy      sql.NullInt64
+	ExpiresAt      sql.NullTime
+	MaxUses        sql.NullInt64
+	Uses           int64
+	Revoked        int64
+	CreatedAt      time.Time
 }
 
 type Message struct {
-	ID             int64
+	ID                    int64
+	ConversationID        int64
+	SenderID              sql.NullInt64
+	Content               string
+	SentAt                time.Time
+	EventType             sql.NullString
+	EventPayload          sql.NullString
+	ReplyToID             sql.NullInt64
+	EditedAt              sql.NullTime
+	DeletedAt             sql.NullTime
+	ForwardSenderID       sql.NullInt64
+	ForwardConversationID sql.NullInt64
+}
+
+type MessageRevision struct {
+	ID         int64
+	MessageID  int64
+	Content    string
+	WrittenAt  time.Time
+	ReplacedAt time.Time
+}
+
+type PinnedMessage struct {
+	MessageID      int64
+	ConversationID int64
+	PinnedBy       sql.NullInt64
+	PinnedAt       time.Time
+}
+
+type Reaction struct {
+	MessageID int64
+	UserID    int64
+	Emoji     string
+	CreatedAt time.Time
+}
+
+type UploadSession struct {
+	ID             string
+	UserID         int64
 	ConversationID int64
-	SenderID       sql.NullInt64
-	Content        string
-	SentAt         time.Time
+	FileName       string
+	Size           int64
+	UploadOffset   int64
+	StorageKey     sql.NullString
+	ContentType    sql.NullString
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
 }
 
 type User struct {
@@ -42,4 +132,6 @@ type User struct {
 	EmailConfirmed     int64
 	AvatarPath         sql.NullString
 	CreatedAt          time.Time
+	LastSeenAt         sql.NullTime
+	HideLastSeen       int64
 }
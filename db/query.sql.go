@@ -8,24 +8,45 @@ package db
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"time"
 )
 
 const addParticipantsToChat = `-- name: AddParticipantsToChat :exec
-INSERT INTO conversation_participants (user_id, conversation_id, is_admin) VALUES (?, ?, ?)
+INSERT INTO conversation_participants (user_id, conversation_id, role) VALUES (?, ?, ?)
 `
 
 type AddParticipantsToChatParams struct {
 	UserID         int64
 	ConversationID int64
-	IsAdmin        sql.NullInt64
+	Role           string
 }
 
 // conversation_participants
 func (q *Queries) AddParticipantsToChat(ctx context.Context, arg AddParticipantsToChatParams) error {
-	_, err := q.db.ExecContext(ctx, addParticipantsToChat, arg.UserID, arg.ConversationID, arg.IsAdmin)
+	_, err := q.db.ExecContext(ctx, addParticipantsToChat, arg.UserID, arg.ConversationID, arg.Role)
 	return err
 }
 
+const addReaction = `-- name: AddReaction :execrows
+INSERT OR IGNORE INTO reactions (message_id, user_id, emoji) VALUES (?, ?, ?)
+`
+
+type AddReactionParams struct {
+	MessageID int64
+	UserID    int64
+	Emoji     string
+}
+
+// Reactions
+func (q *Queries) AddReaction(ctx context.Context, arg AddReactionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, addReaction, arg.MessageID, arg.UserID, arg.Emoji)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const checkPrivateChatExist = `-- name: CheckPrivateChatExist :one
 select c.id from conversations c
                      join conversation_participants cp on cp.conversation_id = c.id
@@ -72,6 +93,24 @@ func (q *Queries) CheckUserInChat(ctx context.Context, arg CheckUserInChatParams
 	return exist, err
 }
 
+const completeUploadSession = `-- name: CompleteUploadSession :execrows
+UPDATE upload_sessions SET storage_key = ?, content_type = ? WHERE id = ?
+`
+
+type CompleteUploadSessionParams struct {
+	StorageKey  sql.NullString
+	ContentType sql.NullString
+	ID          string
+}
+
+func (q *Queries) CompleteUploadSession(ctx context.Context, arg CompleteUploadSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeUploadSession, arg.StorageKey, arg.ContentType, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const confirmAccount = `-- name: ConfirmAccount :exec
 UPDATE users SET email_confirmed = 1 WHERE id = ?
 `
@@ -81,41 +120,218 @@ func (q *Queries) ConfirmAccount(ctx context.Context, id int64) error {
 	return err
 }
 
+const countChatOwners = `-- name: CountChatOwners :one
+SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ? and role = 'owner'
+`
+
+func (q *Queries) CountChatOwners(ctx context.Context, conversationID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChatOwners, conversationID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countChatParticipants = `-- name: CountChatParticipants :one
+SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?
+`
+
+func (q *Queries) CountChatParticipants(ctx context.Context, conversationID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChatParticipants, conversationID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAttachment = `-- name: CreateAttachment :one
+INSERT INTO attachments (message_id, storage_key, file_name, content_type, size, thumbnail_status) VALUES (?, ?, ?, ?, ?, ?) RETURNING id, message_id, storage_key, file_name, content_type, size, created_at, width, height, thumbnail_key, thumbnail_status
+`
+
+type CreateAttachmentParams struct {
+	MessageID       int64
+	StorageKey      string
+	FileName        string
+	ContentType     string
+	Size            int64
+	ThumbnailStatus string
+}
+
+// Attachments
+func (q *Queries) CreateAttachment(ctx context.Context, arg CreateAttachmentParams) (Attachment, error) {
+	row := q.db.QueryRowContext(ctx, createAttachment,
+		arg.MessageID,
+		arg.StorageKey,
+		arg.FileName,
+		arg.ContentType,
+		arg.Size,
+		arg.ThumbnailStatus,
+	)
+	var i Attachment
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.StorageKey,
+		&i.FileName,
+		&i.ContentType,
+		&i.Size,
+		&i.CreatedAt,
+		&i.Width,
+		&i.Height,
+		&i.ThumbnailKey,
+		&i.ThumbnailStatus,
+	)
+	return i, err
+}
+
 const createConversation = `-- name: CreateConversation :one
-INSERT INTO conversations (is_group, name) VALUES (?, ?) RETURNING id, is_group, name, created_at
+INSERT INTO conversations (is_group, name, is_channel) VALUES (?, ?, ?) RETURNING id, is_group, name, created_at, description, avatar_path, is_channel
 `
 
 type CreateConversationParams struct {
-	IsGroup sql.NullInt64
-	Name    sql.NullString
+	IsGroup   sql.NullInt64
+	Name      sql.NullString
+	IsChannel int64
 }
 
 // Conversations
 func (q *Queries) CreateConversation(ctx context.Context, arg CreateConversationParams) (Conversation, error) {
-	row := q.db.QueryRowContext(ctx, createConversation, arg.IsGroup, arg.Name)
+	row := q.db.QueryRowContext(ctx, createConversation, arg.IsGroup, arg.Name, arg.IsChannel)
 	var i Conversation
 	err := row.Scan(
 		&i.ID,
 		&i.IsGroup,
 		&i.Name,
 		&i.CreatedAt,
+		&i.Description,
+		&i.AvatarPath,
+		&i.IsChannel,
+	)
+	return i, err
+}
+
+const createForwardedMessage = `-- name: CreateForwardedMessage :one
+INSERT INTO messages (conversation_id, sender_id, content, forward_sender_id, forward_conversation_id)
+VALUES (?, ?, ?, ?, ?) RETURNING id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id
+`
+
+type CreateForwardedMessageParams struct {
+	ConversationID        int64
+	SenderID              sql.NullInt64
+	Content               string
+	ForwardSenderID       sql.NullInt64
+	ForwardConversationID sql.NullInt64
+}
+
+func (q *Queries) CreateForwardedMessage(ctx context.Context, arg CreateForwardedMessageParams) (Message, error) {
+	row := q.db.QueryRowContext(ctx, createForwardedMessage,
+		arg.ConversationID,
+		arg.SenderID,
+		arg.Content,
+		arg.ForwardSenderID,
+		arg.ForwardConversationID,
+	)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Content,
+		&i.SentAt,
+		&i.EventType,
+		&i.EventPayload,
+		&i.ReplyToID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ForwardSenderID,
+		&i.ForwardConversationID,
+	)
+	return i, err
+}
+
+const createInvite = `-- name: CreateInvite :one
+INSERT INTO invites (code, conversation_id, created_by, expires_at, max_uses) VALUES (?, ?, ?, ?, ?) RETURNING id, code, conversation_id, created_by, expires_at, max_uses, uses, revoked, created_at
+`
+
+type CreateInviteParams struct {
+	Code           string
+	ConversationID int64
+	CreatedBy      sql.NullInt64
+	ExpiresAt      sql.NullTime
+	MaxUses        sql.NullInt64
+}
+
+// Invites
+func (q *Queries) CreateInvite(ctx context.Context, arg CreateInviteParams) (Invite, error) {
+	row := q.db.QueryRowContext(ctx, createInvite,
+		arg.Code,
+		arg.ConversationID,
+		arg.CreatedBy,
+		arg.ExpiresAt,
+		arg.MaxUses,
+	)
+	var i Invite
+	err := row.Scan(
+		&i.ID,
+		&i.Code,
+		&i.ConversationID,
+		&i.CreatedBy,
+		&i.ExpiresAt,
+		&i.MaxUses,
+		&i.Uses,
+		&i.Revoked,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
 const createMessage = `-- name: CreateMessage :one
-INSERT INTO messages (conversation_id, sender_id, content) VALUES (?, ?, ?) RETURNING id, conversation_id, sender_id, content, sent_at
+INSERT INTO messages (conversation_id, sender_id, content, reply_to_id) VALUES (?, ?, ?, ?) RETURNING id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id
 `
 
 type CreateMessageParams struct {
 	ConversationID int64
 	SenderID       sql.NullInt64
 	Content        string
+	ReplyToID      sql.NullInt64
 }
 
 // Messages
 func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
-	row := q.db.QueryRowContext(ctx, createMessage, arg.ConversationID, arg.SenderID, arg.Content)
+	row := q.db.QueryRowContext(ctx, createMessage,
+		arg.ConversationID,
+		arg.SenderID,
+		arg.Content,
+		arg.ReplyToID,
+	)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Content,
+		&i.SentAt,
+		&i.EventType,
+		&i.EventPayload,
+		&i.ReplyToID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ForwardSenderID,
+		&i.ForwardConversationID,
+	)
+	return i, err
+}
+
+const createSystemMessage = `-- name: CreateSystemMessage :one
+INSERT INTO messages (conversation_id, content, event_type, event_payload) VALUES (?, '', ?, ?) RETURNING id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id
+`
+
+type CreateSystemMessageParams struct {
+	ConversationID int64
+	EventType      sql.NullString
+	EventPayload   sql.NullString
+}
+
+func (q *Queries) CreateSystemMessage(ctx context.Context, arg CreateSystemMessageParams) (Message, error) {
+	row := q.db.QueryRowContext(ctx, createSystemMessage, arg.ConversationID, arg.EventType, arg.EventPayload)
 	var i Message
 	err := row.Scan(
 		&i.ID,
@@ -123,13 +339,59 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (M
 		&i.SenderID,
 		&i.Content,
 		&i.SentAt,
+		&i.EventType,
+		&i.EventPayload,
+		&i.ReplyToID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ForwardSenderID,
+		&i.ForwardConversationID,
+	)
+	return i, err
+}
+
+const createUploadSession = `-- name: CreateUploadSession :one
+INSERT INTO upload_sessions (id, user_id, conversation_id, file_name, size, expires_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id, user_id, conversation_id, file_name, size, upload_offset, storage_key, content_type, created_at, expires_at
+`
+
+type CreateUploadSessionParams struct {
+	ID             string
+	UserID         int64
+	ConversationID int64
+	FileName       string
+	Size           int64
+	ExpiresAt      time.Time
+}
+
+// Upload sessions
+func (q *Queries) CreateUploadSession(ctx context.Context, arg CreateUploadSessionParams) (UploadSession, error) {
+	row := q.db.QueryRowContext(ctx, createUploadSession,
+		arg.ID,
+		arg.UserID,
+		arg.ConversationID,
+		arg.FileName,
+		arg.Size,
+		arg.ExpiresAt,
+	)
+	var i UploadSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ConversationID,
+		&i.FileName,
+		&i.Size,
+		&i.UploadOffset,
+		&i.StorageKey,
+		&i.ContentType,
+		&i.CreatedAt,
+		&i.ExpiresAt,
 	)
 	return i, err
 }
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (username,username_normalized, password_hash, email, email_normalized)
-VALUES (?1,LOWER(?1), ?2,?3, LOWER(?3)) RETURNING id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at
+VALUES (?1,LOWER(?1), ?2,?3, LOWER(?3)) RETURNING id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at, last_seen_at, hide_last_seen
 `
 
 type CreateUserParams struct {
@@ -151,6 +413,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.EmailConfirmed,
 		&i.AvatarPath,
 		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.HideLastSeen,
 	)
 	return i, err
 }
@@ -173,6 +437,56 @@ func (q *Queries) DeleteMessage(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteMessageAttachments = `-- name: DeleteMessageAttachments :many
+DELETE FROM attachments WHERE message_id = ? RETURNING storage_key, thumbnail_key
+`
+
+type DeleteMessageAttachmentsRow struct {
+	StorageKey   string
+	ThumbnailKey sql.NullString
+}
+
+func (q *Queries) DeleteMessageAttachments(ctx context.Context, messageID int64) ([]DeleteMessageAttachmentsRow, error) {
+	rows, err := q.db.QueryContext(ctx, deleteMessageAttachments, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteMessageAttachmentsRow
+	for rows.Next() {
+		var i DeleteMessageAttachmentsRow
+		if err := rows.Scan(&i.StorageKey, &i.ThumbnailKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteMessageReactions = `-- name: DeleteMessageReactions :exec
+DELETE FROM reactions WHERE message_id = ?
+`
+
+func (q *Queries) DeleteMessageReactions(ctx context.Context, messageID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteMessageReactions, messageID)
+	return err
+}
+
+const deleteMessageRevisions = `-- name: DeleteMessageRevisions :exec
+DELETE FROM message_revisions WHERE message_id = ?
+`
+
+func (q *Queries) DeleteMessageRevisions(ctx context.Context, messageID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteMessageRevisions, messageID)
+	return err
+}
+
 const deleteParticipantsFromChat = `-- name: DeleteParticipantsFromChat :exec
 DELETE FROM conversation_participants WHERE user_id = ? and conversation_id = ?
 `
@@ -187,6 +501,18 @@ func (q *Queries) DeleteParticipantsFromChat(ctx context.Context, arg DeletePart
 	return err
 }
 
+const deleteUploadSession = `-- name: DeleteUploadSession :execrows
+DELETE FROM upload_sessions WHERE id = ?
+`
+
+func (q *Queries) DeleteUploadSession(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUploadSession, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUser = `-- name: DeleteUser :exec
 DELETE FROM users WHERE id = ?
 `
@@ -196,47 +522,114 @@ func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
 	return err
 }
 
-const getConversationById = `-- name: GetConversationById :one
-SELECT id, is_group, name, created_at FROM conversations WHERE id = ? LIMIT 1
+const getAttachment = `-- name: GetAttachment :one
+SELECT a.id, a.message_id, a.storage_key, a.file_name, a.content_type, a.size, a.created_at, a.width, a.height, a.thumbnail_key, a.thumbnail_status, m.conversation_id
+FROM attachments a
+         JOIN messages m on m.id = a.message_id
+WHERE a.id = ? LIMIT 1
 `
 
-func (q *Queries) GetConversationById(ctx context.Context, id int64) (Conversation, error) {
-	row := q.db.QueryRowContext(ctx, getConversationById, id)
-	var i Conversation
+type GetAttachmentRow struct {
+	ID              int64
+	MessageID       int64
+	StorageKey      string
+	FileName        string
+	ContentType     string
+	Size            int64
+	CreatedAt       time.Time
+	Width           sql.NullInt64
+	Height          sql.NullInt64
+	ThumbnailKey    sql.NullString
+	ThumbnailStatus string
+	ConversationID  int64
+}
+
+func (q *Queries) GetAttachment(ctx context.Context, id int64) (GetAttachmentRow, error) {
+	row := q.db.QueryRowContext(ctx, getAttachment, id)
+	var i GetAttachmentRow
 	err := row.Scan(
 		&i.ID,
-		&i.IsGroup,
-		&i.Name,
+		&i.MessageID,
+		&i.StorageKey,
+		&i.FileName,
+		&i.ContentType,
+		&i.Size,
 		&i.CreatedAt,
+		&i.Width,
+		&i.Height,
+		&i.ThumbnailKey,
+		&i.ThumbnailStatus,
+		&i.ConversationID,
 	)
 	return i, err
 }
 
-const getLatestChats = `-- name: GetLatestChats :many
-select m.id, m.conversation_id, m.sender_id, m.content, m.sent_at from messages m
-                    JOIN (SELECT conversation_id, MAX(sent_at) as last_sent
-                          from messages GROUP BY conversation_id) latest on m.conversation_id = latest.conversation_id
-    and m.sent_at = latest.last_sent
-                    JOIN conversation_participants cp on cp.conversation_id = m.conversation_id
-where cp.user_id = ?
-order by m.sent_at desc
+const getChangesSince = `-- name: GetChangesSince :many
+SELECT c.id, c.conversation_id, c.kind, c.message_id, c.user_id, c.created_at,
+       m.sender_id, m.content, m.sent_at, m.event_type, m.event_payload, m.reply_to_id, m.edited_at, m.deleted_at,
+       m.forward_sender_id, m.forward_conversation_id
+from changes c
+         LEFT JOIN messages m on m.id = c.message_id
+where c.id > ?1
+  and (c.conversation_id IN (SELECT cp.conversation_id FROM conversation_participants cp WHERE cp.user_id = ?2)
+    or (c.user_id = ?2 and c.kind LIKE 'member.%'))
+  and (c.message_id IS NULL or c.message_id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = ?2))
+order by c.id
+LIMIT ?3
 `
 
-func (q *Queries) GetLatestChats(ctx context.Context, userID int64) ([]Message, error) {
-	rows, err := q.db.QueryContext(ctx, getLatestChats, userID)
+type GetChangesSinceParams struct {
+	Since  int64
+	UserID int64
+	Limit  int64
+}
+
+type GetChangesSinceRow struct {
+	ID                    int64
+	ConversationID        int64
+	Kind                  string
+	MessageID             sql.NullInt64
+	UserID                sql.NullInt64
+	CreatedAt             time.Time
+	SenderID              sql.NullInt64
+	Content               sql.NullString
+	SentAt                sql.NullTime
+	EventType             sql.NullString
+	EventPayload          sql.NullString
+	ReplyToID             sql.NullInt64
+	EditedAt              sql.NullTime
+	DeletedAt             sql.NullTime
+	ForwardSenderID       sql.NullInt64
+	ForwardConversationID sql.NullInt64
+}
+
+// Sync
+func (q *Queries) GetChangesSince(ctx context.Context, arg GetChangesSinceParams) ([]GetChangesSinceRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChangesSince, arg.Since, arg.UserID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Message
+	var items []GetChangesSinceRow
 	for rows.Next() {
-		var i Message
+		var i GetChangesSinceRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.ConversationID,
+			&i.Kind,
+			&i.MessageID,
+			&i.UserID,
+			&i.CreatedAt,
 			&i.SenderID,
 			&i.Content,
 			&i.SentAt,
+			&i.EventType,
+			&i.EventPayload,
+			&i.ReplyToID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ForwardSenderID,
+			&i.ForwardConversationID,
 		); err != nil {
 			return nil, err
 		}
@@ -251,50 +644,78 @@ func (q *Queries) GetLatestChats(ctx context.Context, userID int64) ([]Message,
 	return items, nil
 }
 
-const getMessageById = `-- name: GetMessageById :one
-SELECT id, conversation_id, sender_id, content, sent_at from messages WHERE id = ? LIMIT 1
+const getChatInvites = `-- name: GetChatInvites :many
+SELECT id, code, conversation_id, created_by, expires_at, max_uses, uses, revoked, created_at FROM invites WHERE conversation_id = ? and revoked = 0 ORDER BY id DESC
 `
 
-func (q *Queries) GetMessageById(ctx context.Context, id int64) (Message, error) {
-	row := q.db.QueryRowContext(ctx, getMessageById, id)
-	var i Message
-	err := row.Scan(
-		&i.ID,
-		&i.ConversationID,
-		&i.SenderID,
-		&i.Content,
-		&i.SentAt,
-	)
-	return i, err
+func (q *Queries) GetChatInvites(ctx context.Context, conversationID int64) ([]Invite, error) {
+	rows, err := q.db.QueryContext(ctx, getChatInvites, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Invite
+	for rows.Next() {
+		var i Invite
+		if err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.ConversationID,
+			&i.CreatedBy,
+			&i.ExpiresAt,
+			&i.MaxUses,
+			&i.Uses,
+			&i.Revoked,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getMessageThread = `-- name: GetMessageThread :many
-SELECT id, conversation_id, sender_id, content, sent_at FROM messages WHERE conversation_id = ?
-                       ORDER BY sent_at DESC
-                           LIMIT ? OFFSET ?
+const getChatMembers = `-- name: GetChatMembers :many
+SELECT u.id, u.username, u.avatar_path, u.last_seen_at, u.hide_last_seen, cp.role, cp.joined_at
+FROM conversation_participants cp
+         JOIN users u on u.id = cp.user_id
+WHERE cp.conversation_id = ?
+ORDER BY cp.joined_at
 `
 
-type GetMessageThreadParams struct {
-	ConversationID int64
-	Limit          int64
-	Offset         int64
+type GetChatMembersRow struct {
+	ID           int64
+	Username     sql.NullString
+	AvatarPath   sql.NullString
+	LastSeenAt   sql.NullTime
+	HideLastSeen int64
+	Role         string
+	JoinedAt     sql.NullTime
 }
 
-func (q *Queries) GetMessageThread(ctx context.Context, arg GetMessageThreadParams) ([]Message, error) {
-	rows, err := q.db.QueryContext(ctx, getMessageThread, arg.ConversationID, arg.Limit, arg.Offset)
+func (q *Queries) GetChatMembers(ctx context.Context, conversationID int64) ([]GetChatMembersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChatMembers, conversationID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Message
+	var items []GetChatMembersRow
 	for rows.Next() {
-		var i Message
+		var i GetChatMembersRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.ConversationID,
-			&i.SenderID,
-			&i.Content,
-			&i.SentAt,
+			&i.Username,
+			&i.AvatarPath,
+			&i.LastSeenAt,
+			&i.HideLastSeen,
+			&i.Role,
+			&i.JoinedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -309,52 +730,858 @@ func (q *Queries) GetMessageThread(ctx context.Context, arg GetMessageThreadPara
 	return items, nil
 }
 
-const getUser = `-- name: GetUser :one
-SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at from users
-WHERE id = ? LIMIT 1
+const getConversationAttachmentKeys = `-- name: GetConversationAttachmentKeys :many
+SELECT a.storage_key, a.thumbnail_key FROM attachments a JOIN messages m on m.id = a.message_id WHERE m.conversation_id = ?
 `
 
-func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser, id)
-	var i User
+type GetConversationAttachmentKeysRow struct {
+	StorageKey   string
+	ThumbnailKey sql.NullString
+}
+
+func (q *Queries) GetConversationAttachmentKeys(ctx context.Context, conversationID int64) ([]GetConversationAttachmentKeysRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationAttachmentKeys, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationAttachmentKeysRow
+	for rows.Next() {
+		var i GetConversationAttachmentKeysRow
+		if err := rows.Scan(&i.StorageKey, &i.ThumbnailKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationById = `-- name: GetConversationById :one
+SELECT id, is_group, name, created_at, description, avatar_path, is_channel FROM conversations WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetConversationById(ctx context.Context, id int64) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, getConversationById, id)
+	var i Conversation
 	err := row.Scan(
 		&i.ID,
-		&i.Username,
-		&i.UsernameNormalized,
-		&i.PasswordHash,
-		&i.Email,
-		&i.EmailNormalized,
-		&i.EmailConfirmed,
-		&i.AvatarPath,
+		&i.IsGroup,
+		&i.Name,
 		&i.CreatedAt,
+		&i.Description,
+		&i.AvatarPath,
+		&i.IsChannel,
 	)
 	return i, err
 }
 
-const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at from users
-WHERE email_normalized = LOWER(?) LIMIT 1
+const getConversationUploadSessions = `-- name: GetConversationUploadSessions :many
+SELECT id, user_id, conversation_id, file_name, size, upload_offset, storage_key, content_type, created_at, expires_at FROM upload_sessions WHERE conversation_id = ?
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, lower string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByEmail, lower)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.Username,
-		&i.UsernameNormalized,
-		&i.PasswordHash,
-		&i.Email,
-		&i.EmailNormalized,
+func (q *Queries) GetConversationUploadSessions(ctx context.Context, conversationID int64) ([]UploadSession, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationUploadSessions, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadSession
+	for rows.Next() {
+		var i UploadSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ConversationID,
+			&i.FileName,
+			&i.Size,
+			&i.UploadOffset,
+			&i.StorageKey,
+			&i.ContentType,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExpiredUploadSessions = `-- name: GetExpiredUploadSessions :many
+SELECT id, user_id, conversation_id, file_name, size, upload_offset, storage_key, content_type, created_at, expires_at FROM upload_sessions WHERE expires_at < ? ORDER BY expires_at LIMIT ?
+`
+
+type GetExpiredUploadSessionsParams struct {
+	ExpiresAt time.Time
+	Limit     int64
+}
+
+func (q *Queries) GetExpiredUploadSessions(ctx context.Context, arg GetExpiredUploadSessionsParams) ([]UploadSession, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredUploadSessions, arg.ExpiresAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadSession
+	for rows.Next() {
+		var i UploadSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ConversationID,
+			&i.FileName,
+			&i.Size,
+			&i.UploadOffset,
+			&i.StorageKey,
+			&i.ContentType,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getInviteByCode = `-- name: GetInviteByCode :one
+SELECT id, code, conversation_id, created_by, expires_at, max_uses, uses, revoked, created_at FROM invites WHERE code = ? LIMIT 1
+`
+
+func (q *Queries) GetInviteByCode(ctx context.Context, code string) (Invite, error) {
+	row := q.db.QueryRowContext(ctx, getInviteByCode, code)
+	var i Invite
+	err := row.Scan(
+		&i.ID,
+		&i.Code,
+		&i.ConversationID,
+		&i.CreatedBy,
+		&i.ExpiresAt,
+		&i.MaxUses,
+		&i.Uses,
+		&i.Revoked,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getLastMessageId = `-- name: GetLastMessageId :one
+SELECT CAST(COALESCE(MAX(id), 0) AS INTEGER) as id from messages WHERE conversation_id = ?
+`
+
+func (q *Queries) GetLastMessageId(ctx context.Context, conversationID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLastMessageId, conversationID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getLatestChats = `-- name: GetLatestChats :many
+select m.id, m.conversation_id, m.sender_id, m.content, m.sent_at, m.event_type, m.event_payload, m.reply_to_id, m.edited_at, m.deleted_at, m.forward_sender_id, m.forward_conversation_id, c.is_group, c.is_channel, c.name as chat_name, c.description as chat_description, c.avatar_path as chat_avatar_path,
+       cp.muted_until, cp.archived, cp.pinned_order,
+       (SELECT COUNT(*) FROM messages um
+        WHERE um.conversation_id = m.conversation_id and um.id > cp.last_read_message_id
+          and (um.sender_id IS NULL or um.sender_id != cp.user_id) and um.deleted_at IS NULL
+          and um.id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = cp.user_id)) as unread_count
+from messages m
+                    JOIN conversation_participants cp on cp.conversation_id = m.conversation_id
+                    JOIN conversations c on c.id = m.conversation_id
+where cp.user_id = ?1 and cp.hidden = 0
+  and (cp.archived = 0 or cp.archived = ?2)
+  -- the latest visible message, when there is none the latest deleted or hidden one so the chat is still listed
+  and m.id = (SELECT lm.id FROM messages lm
+                        LEFT JOIN hidden_messages hm on hm.message_id = lm.id and hm.user_id = cp.user_id
+              WHERE lm.conversation_id = m.conversation_id
+              ORDER BY hm.message_id IS NOT NULL, lm.deleted_at IS NOT NULL, lm.id DESC
+              LIMIT 1)
+order by cp.pinned_order IS NULL, cp.pinned_order, m.sent_at desc
+`
+
+type GetLatestChatsParams struct {
+	UserID   int64
+	Archived int64
+}
+
+type GetLatestChatsRow struct {
+	ID                    int64
+	ConversationID        int64
+	SenderID              sql.NullInt64
+	Content               string
+	SentAt                time.Time
+	EventType             sql.NullString
+	EventPayload          sql.NullString
+	ReplyToID             sql.NullInt64
+	EditedAt              sql.NullTime
+	DeletedAt             sql.NullTime
+	ForwardSenderID       sql.NullInt64
+	ForwardConversationID sql.NullInt64
+	IsGroup               sql.NullInt64
+	IsChannel             int64
+	ChatName              sql.NullString
+	ChatDescription       sql.NullString
+	ChatAvatarPath        sql.NullString
+	MutedUntil            sql.NullTime
+	Archived              int64
+	PinnedOrder           sql.NullInt64
+	UnreadCount           int64
+}
+
+func (q *Queries) GetLatestChats(ctx context.Context, arg GetLatestChatsParams) ([]GetLatestChatsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getLatestChats, arg.UserID, arg.Archived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLatestChatsRow
+	for rows.Next() {
+		var i GetLatestChatsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Content,
+			&i.SentAt,
+			&i.EventType,
+			&i.EventPayload,
+			&i.ReplyToID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ForwardSenderID,
+			&i.ForwardConversationID,
+			&i.IsGroup,
+			&i.IsChannel,
+			&i.ChatName,
+			&i.ChatDescription,
+			&i.ChatAvatarPath,
+			&i.MutedUntil,
+			&i.Archived,
+			&i.PinnedOrder,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMaxPinnedOrder = `-- name: GetMaxPinnedOrder :one
+SELECT CAST(COALESCE(MAX(pinned_order), 0) AS INTEGER) FROM conversation_participants WHERE user_id = ?
+`
+
+func (q *Queries) GetMaxPinnedOrder(ctx context.Context, userID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getMaxPinnedOrder, userID)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const getMessageById = `-- name: GetMessageById :one
+SELECT id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id from messages WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetMessageById(ctx context.Context, id int64) (Message, error) {
+	row := q.db.QueryRowContext(ctx, getMessageById, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Content,
+		&i.SentAt,
+		&i.EventType,
+		&i.EventPayload,
+		&i.ReplyToID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ForwardSenderID,
+		&i.ForwardConversationID,
+	)
+	return i, err
+}
+
+const getMessageReaders = `-- name: GetMessageReaders :many
+SELECT u.id, u.username FROM conversation_participants cp
+         JOIN users u on u.id = cp.user_id
+WHERE cp.conversation_id = ? and cp.last_read_message_id >= ?2 and cp.user_id != ?3
+`
+
+type GetMessageReadersParams struct {
+	ConversationID int64
+	MessageID      int64
+	SenderID       int64
+}
+
+type GetMessageReadersRow struct {
+	ID       int64
+	Username sql.NullString
+}
+
+func (q *Queries) GetMessageReaders(ctx context.Context, arg GetMessageReadersParams) ([]GetMessageReadersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getMessageReaders, arg.ConversationID, arg.MessageID, arg.SenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessageReadersRow
+	for rows.Next() {
+		var i GetMessageReadersRow
+		if err := rows.Scan(&i.ID, &i.Username); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessageRevisions = `-- name: GetMessageRevisions :many
+SELECT id, message_id, content, written_at, replaced_at FROM message_revisions WHERE message_id = ? ORDER BY id
+`
+
+func (q *Queries) GetMessageRevisions(ctx context.Context, messageID int64) ([]MessageRevision, error) {
+	rows, err := q.db.QueryContext(ctx, getMessageRevisions, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MessageRevision
+	for rows.Next() {
+		var i MessageRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Content,
+			&i.WrittenAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessageThread = `-- name: GetMessageThread :many
+SELECT id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id FROM messages WHERE conversation_id = ?1
+                         and id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = ?2)
+                       ORDER BY sent_at DESC, id DESC
+                           LIMIT ?4 OFFSET ?3
+`
+
+type GetMessageThreadParams struct {
+	ConversationID int64
+	UserID         int64
+	Offset         int64
+	Limit          int64
+}
+
+func (q *Queries) GetMessageThread(ctx context.Context, arg GetMessageThreadParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, getMessageThread,
+		arg.ConversationID,
+		arg.UserID,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Content,
+			&i.SentAt,
+			&i.EventType,
+			&i.EventPayload,
+			&i.ReplyToID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ForwardSenderID,
+			&i.ForwardConversationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesAttachments = `-- name: GetMessagesAttachments :many
+SELECT id, message_id, storage_key, file_name, content_type, size, created_at, width, height, thumbnail_key, thumbnail_status FROM attachments WHERE message_id IN (/*SLICE:ids*/?) ORDER BY id
+`
+
+func (q *Queries) GetMessagesAttachments(ctx context.Context, ids []int64) ([]Attachment, error) {
+	query := getMessagesAttachments
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Attachment
+	for rows.Next() {
+		var i Attachment
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.StorageKey,
+			&i.FileName,
+			&i.ContentType,
+			&i.Size,
+			&i.CreatedAt,
+			&i.Width,
+			&i.Height,
+			&i.ThumbnailKey,
+			&i.ThumbnailStatus,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesByIds = `-- name: GetMessagesByIds :many
+SELECT id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id from messages WHERE id IN (/*SLICE:ids*/?)
+`
+
+func (q *Queries) GetMessagesByIds(ctx context.Context, ids []int64) ([]Message, error) {
+	query := getMessagesByIds
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Content,
+			&i.SentAt,
+			&i.EventType,
+			&i.EventPayload,
+			&i.ReplyToID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ForwardSenderID,
+			&i.ForwardConversationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesReactions = `-- name: GetMessagesReactions :many
+SELECT message_id, emoji, COUNT(*) as count, CAST(MAX(user_id = ?1) AS INTEGER) as reacted
+FROM reactions
+WHERE message_id IN (/*SLICE:ids*/?)
+GROUP BY message_id, emoji
+ORDER BY MIN(created_at), emoji
+`
+
+type GetMessagesReactionsParams struct {
+	UserID int64
+	Ids    []int64
+}
+
+type GetMessagesReactionsRow struct {
+	MessageID int64
+	Emoji     string
+	Count     int64
+	Reacted   int64
+}
+
+// reactions of given messages grouped by emoji, reacted tells whether user_id is among reacted users
+func (q *Queries) GetMessagesReactions(ctx context.Context, arg GetMessagesReactionsParams) ([]GetMessagesReactionsRow, error) {
+	query := getMessagesReactions
+	var queryParams []interface{}
+	queryParams = append(queryParams, arg.UserID)
+	if len(arg.Ids) > 0 {
+		for _, v := range arg.Ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(arg.Ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMessagesReactionsRow
+	for rows.Next() {
+		var i GetMessagesReactionsRow
+		if err := rows.Scan(
+			&i.MessageID,
+			&i.Emoji,
+			&i.Count,
+			&i.Reacted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getParticipant = `-- name: GetParticipant :one
+SELECT id, user_id, conversation_id, joined_at, role, last_read_message_id, hidden, muted_until, archived, pinned_order FROM conversation_participants WHERE user_id = ? and conversation_id = ? LIMIT 1
+`
+
+type GetParticipantParams struct {
+	UserID         int64
+	ConversationID int64
+}
+
+func (q *Queries) GetParticipant(ctx context.Context, arg GetParticipantParams) (ConversationParticipant, error) {
+	row := q.db.QueryRowContext(ctx, getParticipant, arg.UserID, arg.ConversationID)
+	var i ConversationParticipant
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ConversationID,
+		&i.JoinedAt,
+		&i.Role,
+		&i.LastReadMessageID,
+		&i.Hidden,
+		&i.MutedUntil,
+		&i.Archived,
+		&i.PinnedOrder,
+	)
+	return i, err
+}
+
+const getPendingThumbnails = `-- name: GetPendingThumbnails :many
+SELECT id, message_id, storage_key, file_name, content_type, size, created_at, width, height, thumbnail_key, thumbnail_status FROM attachments WHERE thumbnail_status = 'pending' ORDER BY id LIMIT ?
+`
+
+func (q *Queries) GetPendingThumbnails(ctx context.Context, limit int64) ([]Attachment, error) {
+	rows, err := q.db.QueryContext(ctx, getPendingThumbnails, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Attachment
+	for rows.Next() {
+		var i Attachment
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.StorageKey,
+			&i.FileName,
+			&i.ContentType,
+			&i.Size,
+			&i.CreatedAt,
+			&i.Width,
+			&i.Height,
+			&i.ThumbnailKey,
+			&i.ThumbnailStatus,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPinnedMessageIds = `-- name: GetPinnedMessageIds :many
+SELECT message_id FROM pinned_messages WHERE message_id IN (/*SLICE:ids*/?)
+`
+
+func (q *Queries) GetPinnedMessageIds(ctx context.Context, ids []int64) ([]int64, error) {
+	query := getPinnedMessageIds
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var message_id int64
+		if err := rows.Scan(&message_id); err != nil {
+			return nil, err
+		}
+		items = append(items, message_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPinnedMessages = `-- name: GetPinnedMessages :many
+SELECT m.id, m.conversation_id, m.sender_id, m.content, m.sent_at, m.event_type, m.event_payload, m.reply_to_id, m.edited_at, m.deleted_at, m.forward_sender_id, m.forward_conversation_id FROM messages m
+    JOIN pinned_messages p on p.message_id = m.id
+WHERE p.conversation_id = ?
+ORDER BY p.pinned_at DESC, p.message_id DESC
+`
+
+func (q *Queries) GetPinnedMessages(ctx context.Context, conversationID int64) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, getPinnedMessages, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Content,
+			&i.SentAt,
+			&i.EventType,
+			&i.EventPayload,
+			&i.ReplyToID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ForwardSenderID,
+			&i.ForwardConversationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReplyThread = `-- name: GetReplyThread :many
+WITH RECURSIVE thread(id) AS (
+    SELECT r.id FROM messages r WHERE r.reply_to_id = ?2
+    UNION ALL
+    SELECT n.id FROM messages n JOIN thread t on n.reply_to_id = t.id
+)
+SELECT id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id FROM messages WHERE id IN (SELECT id FROM thread)
+  and id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = ?1)
+ORDER BY sent_at, id
+`
+
+type GetReplyThreadParams struct {
+	UserID int64
+	RootID sql.NullInt64
+}
+
+// every direct and nested reply of the root message
+func (q *Queries) GetReplyThread(ctx context.Context, arg GetReplyThreadParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, getReplyThread, arg.UserID, arg.RootID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Content,
+			&i.SentAt,
+			&i.EventType,
+			&i.EventPayload,
+			&i.ReplyToID,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ForwardSenderID,
+			&i.ForwardConversationID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUploadSession = `-- name: GetUploadSession :one
+SELECT id, user_id, conversation_id, file_name, size, upload_offset, storage_key, content_type, created_at, expires_at FROM upload_sessions WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetUploadSession(ctx context.Context, id string) (UploadSession, error) {
+	row := q.db.QueryRowContext(ctx, getUploadSession, id)
+	var i UploadSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.ConversationID,
+		&i.FileName,
+		&i.Size,
+		&i.UploadOffset,
+		&i.StorageKey,
+		&i.ContentType,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at, last_seen_at, hide_last_seen from users
+WHERE id = ? LIMIT 1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.UsernameNormalized,
+		&i.PasswordHash,
+		&i.Email,
+		&i.EmailNormalized,
+		&i.EmailConfirmed,
+		&i.AvatarPath,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.HideLastSeen,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at, last_seen_at, hide_last_seen from users
+WHERE email_normalized = LOWER(?) LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, lower string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, lower)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.UsernameNormalized,
+		&i.PasswordHash,
+		&i.Email,
+		&i.EmailNormalized,
 		&i.EmailConfirmed,
 		&i.AvatarPath,
 		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.HideLastSeen,
 	)
 	return i, err
 }
 
 const getUserByUsername = `-- name: GetUserByUsername :one
-SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at from users
+SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at, last_seen_at, hide_last_seen from users
 WHERE username_normalized = LOWER(?) LIMIT 1
 `
 
@@ -371,12 +1598,115 @@ func (q *Queries) GetUserByUsername(ctx context.Context, lower string) (User, er
 		&i.EmailConfirmed,
 		&i.AvatarPath,
 		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.HideLastSeen,
 	)
 	return i, err
 }
 
+const getUserConversationIds = `-- name: GetUserConversationIds :many
+SELECT conversation_id FROM conversation_participants WHERE user_id = ?
+`
+
+func (q *Queries) GetUserConversationIds(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getUserConversationIds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var conversation_id int64
+		if err := rows.Scan(&conversation_id); err != nil {
+			return nil, err
+		}
+		items = append(items, conversation_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersPresence = `-- name: GetUsersPresence :many
+SELECT id, last_seen_at, hide_last_seen FROM users WHERE id IN (/*SLICE:ids*/?)
+`
+
+type GetUsersPresenceRow struct {
+	ID           int64
+	LastSeenAt   sql.NullTime
+	HideLastSeen int64
+}
+
+func (q *Queries) GetUsersPresence(ctx context.Context, ids []int64) ([]GetUsersPresenceRow, error) {
+	query := getUsersPresence
+	var queryParams []interface{}
+	if len(ids) > 0 {
+		for _, v := range ids {
+			queryParams = append(queryParams, v)
+		}
+		query = strings.Replace(query, "/*SLICE:ids*/?", strings.Repeat(",?", len(ids))[1:], 1)
+	} else {
+		query = strings.Replace(query, "/*SLICE:ids*/?", "NULL", 1)
+	}
+	rows, err := q.db.QueryContext(ctx, query, queryParams...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersPresenceRow
+	for rows.Next() {
+		var i GetUsersPresenceRow
+		if err := rows.Scan(&i.ID, &i.LastSeenAt, &i.HideLastSeen); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideConversation = `-- name: HideConversation :exec
+UPDATE conversation_participants
+SET hidden = 1,
+    last_read_message_id = (SELECT COALESCE(MAX(m.id), 0) FROM messages m WHERE m.conversation_id = ?1)
+WHERE user_id = ?2 and conversation_id = ?1
+`
+
+type HideConversationParams struct {
+	ConversationID int64
+	UserID         int64
+}
+
+func (q *Queries) HideConversation(ctx context.Context, arg HideConversationParams) error {
+	_, err := q.db.ExecContext(ctx, hideConversation, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const hideMessage = `-- name: HideMessage :exec
+INSERT OR IGNORE INTO hidden_messages (message_id, user_id) VALUES (?, ?)
+`
+
+type HideMessageParams struct {
+	MessageID int64
+	UserID    int64
+}
+
+func (q *Queries) HideMessage(ctx context.Context, arg HideMessageParams) error {
+	_, err := q.db.ExecContext(ctx, hideMessage, arg.MessageID, arg.UserID)
+	return err
+}
+
 const listUsers = `-- name: ListUsers :many
-SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at FROM users
+SELECT id, username, username_normalized, password_hash, email, email_normalized, email_confirmed, avatar_path, created_at, last_seen_at, hide_last_seen FROM users
 ORDER BY username
 `
 
@@ -399,6 +1729,8 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 			&i.EmailConfirmed,
 			&i.AvatarPath,
 			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.HideLastSeen,
 		); err != nil {
 			return nil, err
 		}
@@ -413,6 +1745,222 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const pinMessage = `-- name: PinMessage :execrows
+INSERT OR IGNORE INTO pinned_messages (message_id, conversation_id, pinned_by) VALUES (?, ?, ?)
+`
+
+type PinMessageParams struct {
+	MessageID      int64
+	ConversationID int64
+	PinnedBy       sql.NullInt64
+}
+
+func (q *Queries) PinMessage(ctx context.Context, arg PinMessageParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pinMessage, arg.MessageID, arg.ConversationID, arg.PinnedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const removeReaction = `-- name: RemoveReaction :execrows
+DELETE FROM reactions WHERE message_id = ? and user_id = ? and emoji = ?
+`
+
+type RemoveReactionParams struct {
+	MessageID int64
+	UserID    int64
+	Emoji     string
+}
+
+func (q *Queries) RemoveReaction(ctx context.Context, arg RemoveReactionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeReaction, arg.MessageID, arg.UserID, arg.Emoji)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeInvite = `-- name: RevokeInvite :exec
+UPDATE invites SET revoked = 1 WHERE id = ?
+`
+
+func (q *Queries) RevokeInvite(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, revokeInvite, id)
+	return err
+}
+
+const setAttachmentThumbnail = `-- name: SetAttachmentThumbnail :execrows
+UPDATE attachments SET width = ?, height = ?, thumbnail_key = ?, thumbnail_status = ? WHERE id = ?
+`
+
+type SetAttachmentThumbnailParams struct {
+	Width           sql.NullInt64
+	Height          sql.NullInt64
+	ThumbnailKey    sql.NullString
+	ThumbnailStatus string
+	ID              int64
+}
+
+func (q *Queries) SetAttachmentThumbnail(ctx context.Context, arg SetAttachmentThumbnailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setAttachmentThumbnail,
+		arg.Width,
+		arg.Height,
+		arg.ThumbnailKey,
+		arg.ThumbnailStatus,
+		arg.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setChatArchived = `-- name: SetChatArchived :execrows
+UPDATE conversation_participants SET archived = ? WHERE user_id = ? and conversation_id = ?
+`
+
+type SetChatArchivedParams struct {
+	Archived       int64
+	UserID         int64
+	ConversationID int64
+}
+
+func (q *Queries) SetChatArchived(ctx context.Context, arg SetChatArchivedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setChatArchived, arg.Archived, arg.UserID, arg.ConversationID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setChatMutedUntil = `-- name: SetChatMutedUntil :execrows
+UPDATE conversation_participants SET muted_until = ? WHERE user_id = ? and conversation_id = ?
+`
+
+type SetChatMutedUntilParams struct {
+	MutedUntil     sql.NullTime
+	UserID         int64
+	ConversationID int64
+}
+
+func (q *Queries) SetChatMutedUntil(ctx context.Context, arg SetChatMutedUntilParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setChatMutedUntil, arg.MutedUntil, arg.UserID, arg.ConversationID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setChatPinnedOrder = `-- name: SetChatPinnedOrder :execrows
+UPDATE conversation_participants SET pinned_order = ? WHERE user_id = ? and conversation_id = ?
+`
+
+type SetChatPinnedOrderParams struct {
+	PinnedOrder    sql.NullInt64
+	UserID         int64
+	ConversationID int64
+}
+
+func (q *Queries) SetChatPinnedOrder(ctx context.Context, arg SetChatPinnedOrderParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setChatPinnedOrder, arg.PinnedOrder, arg.UserID, arg.ConversationID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setParticipantRole = `-- name: SetParticipantRole :exec
+UPDATE conversation_participants SET role = ? WHERE user_id = ? and conversation_id = ?
+`
+
+type SetParticipantRoleParams struct {
+	Role           string
+	UserID         int64
+	ConversationID int64
+}
+
+func (q *Queries) SetParticipantRole(ctx context.Context, arg SetParticipantRoleParams) error {
+	_, err := q.db.ExecContext(ctx, setParticipantRole, arg.Role, arg.UserID, arg.ConversationID)
+	return err
+}
+
+const setUploadOffset = `-- name: SetUploadOffset :execrows
+UPDATE upload_sessions SET upload_offset = ?, expires_at = ? WHERE id = ?
+`
+
+type SetUploadOffsetParams struct {
+	UploadOffset int64
+	ExpiresAt    time.Time
+	ID           string
+}
+
+func (q *Queries) SetUploadOffset(ctx context.Context, arg SetUploadOffsetParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUploadOffset, arg.UploadOffset, arg.ExpiresAt, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const softDeleteMessage = `-- name: SoftDeleteMessage :exec
+UPDATE messages SET content = '', event_payload = NULL, deleted_at = CURRENT_TIMESTAMP WHERE id = ? and deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteMessage(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, softDeleteMessage, id)
+	return err
+}
+
+const unhideConversation = `-- name: UnhideConversation :exec
+UPDATE conversation_participants SET hidden = 0 WHERE conversation_id = ? and hidden = 1
+`
+
+func (q *Queries) UnhideConversation(ctx context.Context, conversationID int64) error {
+	_, err := q.db.ExecContext(ctx, unhideConversation, conversationID)
+	return err
+}
+
+const unpinMessage = `-- name: UnpinMessage :execrows
+DELETE FROM pinned_messages WHERE message_id = ?
+`
+
+func (q *Queries) UnpinMessage(ctx context.Context, messageID int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unpinMessage, messageID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateConversationAvatar = `-- name: UpdateConversationAvatar :exec
+UPDATE conversations SET avatar_path = ? WHERE id = ?
+`
+
+type UpdateConversationAvatarParams struct {
+	AvatarPath sql.NullString
+	ID         int64
+}
+
+func (q *Queries) UpdateConversationAvatar(ctx context.Context, arg UpdateConversationAvatarParams) error {
+	_, err := q.db.ExecContext(ctx, updateConversationAvatar, arg.AvatarPath, arg.ID)
+	return err
+}
+
+const updateConversationDescription = `-- name: UpdateConversationDescription :exec
+UPDATE conversations SET description = ? WHERE id = ?
+`
+
+type UpdateConversationDescriptionParams struct {
+	Description sql.NullString
+	ID          int64
+}
+
+func (q *Queries) UpdateConversationDescription(ctx context.Context, arg UpdateConversationDescriptionParams) error {
+	_, err := q.db.ExecContext(ctx, updateConversationDescription, arg.Description, arg.ID)
+	return err
+}
+
 const updateConversationName = `-- name: UpdateConversationName :exec
 UPDATE conversations SET name = ? WHERE id = ?
 `
@@ -427,8 +1975,24 @@ func (q *Queries) UpdateConversationName(ctx context.Context, arg UpdateConversa
 	return err
 }
 
-const updateMessageText = `-- name: UpdateMessageText :exec
-UPDATE messages SET content = ? where id = ?
+const updateLastReadMessage = `-- name: UpdateLastReadMessage :exec
+UPDATE conversation_participants SET last_read_message_id = MAX(last_read_message_id, CAST(?1 AS INTEGER))
+WHERE user_id = ?2 and conversation_id = ?3
+`
+
+type UpdateLastReadMessageParams struct {
+	MessageID      int64
+	UserID         int64
+	ConversationID int64
+}
+
+func (q *Queries) UpdateLastReadMessage(ctx context.Context, arg UpdateLastReadMessageParams) error {
+	_, err := q.db.ExecContext(ctx, updateLastReadMessage, arg.MessageID, arg.UserID, arg.ConversationID)
+	return err
+}
+
+const updateMessageText = `-- name: UpdateMessageText :one
+UPDATE messages SET content = ?, edited_at = CURRENT_TIMESTAMP where id = ? RETURNING id, conversation_id, sender_id, content, sent_at, event_type, event_payload, reply_to_id, edited_at, deleted_at, forward_sender_id, forward_conversation_id
 `
 
 type UpdateMessageTextParams struct {
@@ -436,9 +2000,24 @@ type UpdateMessageTextParams struct {
 	ID      int64
 }
 
-func (q *Queries) UpdateMessageText(ctx context.Context, arg UpdateMessageTextParams) error {
-	_, err := q.db.ExecContext(ctx, updateMessageText, arg.Content, arg.ID)
-	return err
+func (q *Queries) UpdateMessageText(ctx context.Context, arg UpdateMessageTextParams) (Message, error) {
+	row := q.db.QueryRowContext(ctx, updateMessageText, arg.Content, arg.ID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Content,
+		&i.SentAt,
+		&i.EventType,
+		&i.EventPayload,
+		&i.ReplyToID,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ForwardSenderID,
+		&i.ForwardConversationID,
+	)
+	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :exec
@@ -454,3 +2033,43 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	_, err := q.db.ExecContext(ctx, updateUser, arg.Username, arg.ID)
 	return err
 }
+
+const updateUserHideLastSeen = `-- name: UpdateUserHideLastSeen :exec
+UPDATE users SET hide_last_seen = ? WHERE id = ?
+`
+
+type UpdateUserHideLastSeenParams struct {
+	HideLastSeen int64
+	ID           int64
+}
+
+func (q *Queries) UpdateUserHideLastSeen(ctx context.Context, arg UpdateUserHideLastSeenParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserHideLastSeen, arg.HideLastSeen, arg.ID)
+	return err
+}
+
+const updateUserLastSeen = `-- name: UpdateUserLastSeen :exec
+UPDATE users SET last_seen_at = ? WHERE id = ?
+`
+
+type UpdateUserLastSeenParams struct {
+	LastSeenAt sql.NullTime
+	ID         int64
+}
+
+func (q *Queries) UpdateUserLastSeen(ctx context.Context, arg UpdateUserLastSeenParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserLastSeen, arg.LastSeenAt, arg.ID)
+	return err
+}
+
+const useInvite = `-- name: UseInvite :execrows
+UPDATE invites SET uses = uses + 1 WHERE id = ? and revoked = 0 and (max_uses IS NULL or uses < max_uses)
+`
+
+func (q *Queries) UseInvite(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useInvite, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"awesomeProject/api"
 	"awesomeProject/db"
+	"awesomeProject/migrations"
+	"awesomeProject/realtime"
 	"awesomeProject/services"
+	"awesomeProject/storage"
 	"awesomeProject/types"
 	"context"
 	"database/sql"
@@ -13,6 +16,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
 //go:embed schema.sql
@@ -25,18 +29,45 @@ func main() {
 		log.Fatal(err)
 	}
 	types.SecretKey = []byte(os.Getenv("JWT_SECRET"))
-	database, err := sql.Open("sqlite3", "./chat.db")
+	// foreign keys are enforced, so deletes cascade or set references to NULL as declared in schema.sql
+	// and deleting a row which is still referenced fails
+	database, err := sql.Open("sqlite3", "./chat.db?_foreign_keys=on")
 	if err != nil {
 		log.Fatal(err)
 	}
-	if _, err = database.ExecContext(ctx, ddl); err != nil {
+	if err = migrations.Apply(ctx, database, ddl); err != nil {
 		log.Fatal(err)
 	}
 	queries := db.New(database)
 	smtpConfig := types.NewSmtpConfig(os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
 	authController := api.AuthController{Queries: queries, Database: database, Config: smtpConfig}
-	messageSerice := services.NewMessageService(queries, database)
+	hub := realtime.NewHub()
+	files, err := storage.FromEnv(ctx, os.Getenv("STORAGE_DRIVER"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	thumbnailService := services.NewThumbnailService(queries, files, hub)
+	go thumbnailService.Run(ctx)
+	messageSerice := services.NewMessageService(queries, database, hub, files, thumbnailService)
+	// MESSAGE_EDIT_WINDOW like "48h" limits how long messages can be edited, by default there is no limit
+	if window := os.Getenv("MESSAGE_EDIT_WINDOW"); window != "" {
+		if messageSerice.EditWindow, err = time.ParseDuration(window); err != nil {
+			log.Fatal(err)
+		}
+	}
 	messageController := api.ChatController{MessageService: messageSerice}
+	uploadService := services.NewUploadService(queries, messageSerice, types.PartialUploadsDir)
+	go uploadService.Run(ctx)
+	uploadController := api.UploadController{UploadService: uploadService}
+	typingService := services.NewTypingService(queries, hub)
+	presenceService := services.NewPresenceService(queries, hub)
+	conversationService := services.NewConversationService(queries, database, hub, presenceService, files, uploadService)
+	realtimeController := api.RealtimeController{Hub: hub, Queries: queries, TypingService: typingService,
+		PresenceService: presenceService}
+	conversationController := api.ConversationController{ConversationService: conversationService}
+	userController := api.UserController{PresenceService: presenceService}
+	syncController := api.SyncController{SyncService: services.NewSyncService(queries, messageSerice)}
+	inviteController := api.InviteController{InviteService: services.NewInviteService(queries, database, conversationService)}
 	http.HandleFunc("POST /auth/register", authController.Register)
 	http.HandleFunc("POST /auth/login", authController.Login)
 	http.HandleFunc("GET /auth/email_confirmation", authController.ConfirmEmailGet)
@@ -46,10 +77,58 @@ func main() {
 	http.Handle("POST /messages/{chatId}", api.AuthMiddleware(http.HandlerFunc(messageController.SendMessage)))
 	http.Handle("GET /messages", api.AuthMiddleware(http.HandlerFunc(messageController.GetLatestChats)))
 	http.Handle("DELETE /message/{messageId}", api.AuthMiddleware(http.HandlerFunc(messageController.DeleteMessage)))
+	http.Handle("POST /message/{messageId}/hide", api.AuthMiddleware(http.HandlerFunc(messageController.HideMessage)))
+	http.Handle("PUT /message/{messageId}/pin", api.AuthMiddleware(http.HandlerFunc(messageController.PinMessage)))
+	http.Handle("DELETE /message/{messageId}/pin", api.AuthMiddleware(http.HandlerFunc(messageController.UnpinMessage)))
+	http.Handle("GET /chats/{chatId}/pinned", api.AuthMiddleware(http.HandlerFunc(messageController.GetPinnedMessages)))
 	http.Handle("PUT /message/{messageId}", api.AuthMiddleware(http.HandlerFunc(messageController.UpdateMessage)))
 	http.Handle("GET /chats/{chatId}", api.AuthMiddleware(http.HandlerFunc(messageController.GetChatMessages)))
+	http.Handle("GET /ws", api.TokenFromQuery(api.AuthMiddleware(http.HandlerFunc(realtimeController.ServeWs))))
+	http.Handle("GET /events", api.TokenFromQuery(api.AuthMiddleware(http.HandlerFunc(realtimeController.ServeEvents))))
+	http.Handle("POST /chats/{chatId}/typing", api.AuthMiddleware(http.HandlerFunc(realtimeController.StartTyping)))
+	http.Handle("DELETE /chats/{chatId}/typing", api.AuthMiddleware(http.HandlerFunc(realtimeController.StopTyping)))
+	http.Handle("POST /chats/{chatId}/read", api.AuthMiddleware(http.HandlerFunc(messageController.MarkRead)))
+	http.Handle("POST /chats/{chatId}/forward", api.AuthMiddleware(http.HandlerFunc(messageController.ForwardMessages)))
+	http.Handle("POST /chats/{chatId}/attachments", api.AuthMiddleware(http.HandlerFunc(messageController.SendAttachments)))
+	http.Handle("POST /uploads", api.AuthMiddleware(http.HandlerFunc(uploadController.CreateUpload)))
+	http.Handle("GET /uploads/{uploadId}", api.AuthMiddleware(http.HandlerFunc(uploadController.GetUpload)))
+	http.Handle("PATCH /uploads/{uploadId}", api.AuthMiddleware(http.HandlerFunc(uploadController.AppendChunk)))
+	http.Handle("DELETE /uploads/{uploadId}", api.AuthMiddleware(http.HandlerFunc(uploadController.CancelUpload)))
+	http.Handle("GET /attachments/{attachmentId}", api.AuthMiddleware(http.HandlerFunc(messageController.GetAttachment)))
+	http.Handle("GET /attachments/{attachmentId}/thumbnail", api.AuthMiddleware(http.HandlerFunc(messageController.GetAttachmentThumbnail)))
+	http.Handle("GET /message/{messageId}/seen", api.AuthMiddleware(http.HandlerFunc(messageController.GetMessageReaders)))
+	http.Handle("GET /message/{messageId}/thread", api.AuthMiddleware(http.HandlerFunc(messageController.GetThread)))
+	http.Handle("GET /message/{messageId}/history", api.AuthMiddleware(http.HandlerFunc(messageController.GetMessageHistory)))
+	http.Handle("POST /message/{messageId}/reactions", api.AuthMiddleware(http.HandlerFunc(messageController.AddReaction)))
+	http.Handle("DELETE /message/{messageId}/reactions/{emoji}", api.AuthMiddleware(http.HandlerFunc(messageController.RemoveReaction)))
+	http.Handle("POST /chats", api.AuthMiddleware(http.HandlerFunc(conversationController.CreateGroup)))
+	http.Handle("PATCH /chats/{chatId}", api.AuthMiddleware(http.HandlerFunc(conversationController.UpdateChat)))
+	http.Handle("GET /chats/{chatId}/avatar", api.AuthMiddleware(http.HandlerFunc(conversationController.GetAvatar)))
+	http.Handle("PUT /chats/{chatId}/avatar", api.AuthMiddleware(http.HandlerFunc(conversationController.UploadAvatar)))
+	http.Handle("DELETE /chats/{chatId}/avatar", api.AuthMiddleware(http.HandlerFunc(conversationController.DeleteAvatar)))
+	http.Handle("GET /chats/{chatId}/members", api.AuthMiddleware(http.HandlerFunc(conversationController.GetMembers)))
+	http.Handle("POST /chats/{chatId}/members", api.AuthMiddleware(http.HandlerFunc(conversationController.AddMembers)))
+	http.Handle("DELETE /chats/{chatId}/members/{userId}", api.AuthMiddleware(http.HandlerFunc(conversationController.RemoveMember)))
+	http.Handle("PUT /chats/{chatId}/members/{userId}/role", api.AuthMiddleware(http.HandlerFunc(conversationController.SetRole)))
+	http.Handle("POST /chats/{chatId}/owner", api.AuthMiddleware(http.HandlerFunc(conversationController.TransferOwnership)))
+	http.Handle("POST /chats/{chatId}/leave", api.AuthMiddleware(http.HandlerFunc(conversationController.Leave)))
+	http.Handle("POST /chats/{chatId}/hide", api.AuthMiddleware(http.HandlerFunc(conversationController.Hide)))
+	http.Handle("DELETE /chats/{chatId}", api.AuthMiddleware(http.HandlerFunc(conversationController.Delete)))
+	http.Handle("PUT /chats/{chatId}/mute", api.AuthMiddleware(http.HandlerFunc(conversationController.Mute)))
+	http.Handle("DELETE /chats/{chatId}/mute", api.AuthMiddleware(http.HandlerFunc(conversationController.Unmute)))
+	http.Handle("PUT /chats/{chatId}/archive", api.AuthMiddleware(http.HandlerFunc(conversationController.Archive)))
+	http.Handle("DELETE /chats/{chatId}/archive", api.AuthMiddleware(http.HandlerFunc(conversationController.Unarchive)))
+	http.Handle("PUT /chats/{chatId}/pin", api.AuthMiddleware(http.HandlerFunc(conversationController.Pin)))
+	http.Handle("DELETE /chats/{chatId}/pin", api.AuthMiddleware(http.HandlerFunc(conversationController.Unpin)))
+	http.Handle("POST /chats/{chatId}/invites", api.AuthMiddleware(http.HandlerFunc(inviteController.CreateInvite)))
+	http.Handle("GET /chats/{chatId}/invites", api.AuthMiddleware(http.HandlerFunc(inviteController.GetInvites)))
+	http.Handle("DELETE /invites/{code}", api.AuthMiddleware(http.HandlerFunc(inviteController.RevokeInvite)))
+	http.Handle("POST /invites/{code}/accept", api.AuthMiddleware(http.HandlerFunc(inviteController.AcceptInvite)))
+	http.Handle("GET /users/presence", api.AuthMiddleware(http.HandlerFunc(userController.GetPresence)))
+	http.Handle("PUT /users/me/privacy", api.AuthMiddleware(http.HandlerFunc(userController.UpdatePrivacy)))
+	http.Handle("GET /sync", api.AuthMiddleware(http.HandlerFunc(syncController.Sync)))
 	log.Println("Stat server on 5000 port")
-	http.ListenAndServe(":5000", nil)
+	http.ListenAndServe(":5000", api.PresenceMiddleware(presenceService, http.DefaultServeMux))
 }
 
 // SendMessage check what user in chat
@@ -0,0 +1,215 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// step upgrades schema of a database created by an older version, it must be safe to run on a database
+// which already has some of its changes
+type step func(ctx context.Context, tx *sql.Tx) error
+
+// steps are applied in order, PRAGMA user_version keeps the number of applied steps.
+// New columns of existing tables go here, new tables, indexes and triggers are created by schema.sql
+var steps = []step{
+	// 1: presence and read receipts
+	func(ctx context.Context, tx *sql.Tx) error {
+		return addColumns(ctx, tx,
+			"users", "last_seen_at TIMESTAMP",
+			"users", "hide_last_seen INTEGER NOT NULL CHECK (hide_last_seen in (0, 1)) DEFAULT 0",
+			"conversation_participants", "last_read_message_id INTEGER NOT NULL DEFAULT 0",
+		)
+	},
+	// 2: roles replace is_admin, admins keep their rights and the earliest admin of a group becomes its owner,
+	// groups without admins get their earliest participant as owner
+	func(ctx context.Context, tx *sql.Tx) error {
+		legacy, err := hasColumn(ctx, tx, "conversation_participants", "is_admin")
+		if err != nil || !legacy {
+			return err
+		}
+		if err = addColumns(ctx, tx, "conversation_participants",
+			"role TEXT NOT NULL CHECK (role in ('owner', 'admin', 'member', 'readonly')) DEFAULT 'member'"); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+UPDATE conversation_participants SET role = 'admin' WHERE is_admin = 1;
+UPDATE conversation_participants SET role = 'owner'
+WHERE id IN (SELECT MIN(p.id)
+             FROM conversation_participants p
+                      JOIN conversations c on c.id = p.conversation_id
+             WHERE p.is_admin = 1 and c.is_group = 1
+             GROUP BY p.conversation_id);
+UPDATE conversation_participants SET role = 'owner'
+WHERE id IN (SELECT MIN(p.id)
+             FROM conversation_participants p
+                      JOIN conversations c on c.id = p.conversation_id
+             WHERE c.is_group = 1
+             GROUP BY p.conversation_id
+             HAVING SUM(p.is_admin = 1) = 0);
+DROP TRIGGER IF EXISTS trg_member_updated;
+ALTER TABLE conversation_participants DROP COLUMN is_admin;`)
+		return err
+	},
+	// 3: messages of deleted users stay without sender instead of blocking the delete. SQLite can't change
+	// a constraint in place, the table is rebuilt: a copy is created with the new definition, filled, and
+	// takes the place of the old one. Its indexes and triggers are created again by schema.sql
+	func(ctx context.Context, tx *sql.Tx) error {
+		var definition string
+		err := tx.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' and name = 'messages'").Scan(&definition)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		const senderColumn = "sender_id INTEGER REFERENCES users(id),"
+		if !strings.Contains(definition, senderColumn) {
+			return nil
+		}
+		definition = strings.Replace(definition, senderColumn, "sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL,", 1)
+		definition = strings.Replace(definition, "messages", "messages_new", 1)
+		// ids of deleted messages must not be given again, the sequence of the old table is kept
+		var sequence int64
+		err = tx.QueryRowContext(ctx, "SELECT seq FROM sqlite_sequence WHERE name = 'messages'").Scan(&sequence)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		for _, query := range []string{
+			"DROP TABLE IF EXISTS messages_new",
+			definition,
+			"INSERT INTO messages_new SELECT * FROM messages",
+			"DROP TABLE messages",
+			"ALTER TABLE messages_new RENAME TO messages",
+		} {
+			if _, err = tx.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE sqlite_sequence SET seq = MAX(seq, ?) WHERE name = 'messages'", sequence)
+		return err
+	},
+	// 4: group settings, system messages, replies, edits, soft delete, forwards and per-chat state.
+	// Message triggers changed with soft delete, they are dropped to be created again by schema.sql
+	func(ctx context.Context, tx *sql.Tx) error {
+		if err := addColumns(ctx, tx,
+			"conversations", "description TEXT",
+			"conversations", "avatar_path TEXT",
+			"conversations", "is_channel INTEGER NOT NULL CHECK (is_channel in (0, 1)) DEFAULT 0",
+			"conversation_participants", "hidden INTEGER NOT NULL CHECK (hidden in (0, 1)) DEFAULT 0",
+			"conversation_participants", "muted_until TIMESTAMP",
+			"conversation_participants", "archived INTEGER NOT NULL CHECK (archived in (0, 1)) DEFAULT 0",
+			"conversation_participants", "pinned_order INTEGER",
+			"messages", "event_type TEXT",
+			"messages", "event_payload TEXT",
+			"messages", "reply_to_id INTEGER REFERENCES messages(id) ON DELETE SET NULL",
+			"messages", "edited_at TIMESTAMP",
+			"messages", "deleted_at TIMESTAMP",
+			"messages", "forward_sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL",
+			"messages", "forward_conversation_id INTEGER REFERENCES conversations(id) ON DELETE SET NULL",
+		); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+DROP TRIGGER IF EXISTS trg_message_updated;
+DROP TRIGGER IF EXISTS trg_message_revision;`)
+		return err
+	},
+}
+
+// Apply brings the database to the current schema. Pending steps run first, then ddl creates
+// everything missing. New databases get the whole schema from ddl and skip the steps.
+// Foreign keys are off while tables are rebuilt and checked before the commit
+func Apply(ctx context.Context, database *sql.DB, ddl string) error {
+	// PRAGMA foreign_keys is a no-op inside a transaction, it is switched on the connection of the transaction
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var foreignKeys int
+	if err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return err
+	}
+	if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), fmt.Sprintf("PRAGMA foreign_keys = %d", foreignKeys))
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version, tables int
+	if err = tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if err = tx.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' and name = 'users'").Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		version = len(steps)
+	}
+	for i := version; i < len(steps); i++ {
+		if err = steps[i](ctx, tx); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, ddl); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", len(steps))); err != nil {
+		return err
+	}
+	if foreignKeys == 1 && version < len(steps) {
+		if err = checkForeignKeys(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// checkForeignKeys fails when a row references a missing row
+func checkForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table, parent string
+		var rowId sql.NullInt64
+		var index int
+		if err = rows.Scan(&table, &rowId, &parent, &index); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s references missing row of %s", rowId.Int64, table, parent)
+	}
+	return rows.Err()
+}
+
+// addColumns takes pairs of table and column definition, columns which already exist are skipped
+func addColumns(ctx context.Context, tx *sql.Tx, columns ...string) error {
+	for i := 0; i+1 < len(columns); i += 2 {
+		table, definition := columns[i], columns[i+1]
+		exists, err := hasColumn(ctx, tx, table, strings.Fields(definition)[0])
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasColumn(ctx context.Context, tx *sql.Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	return count > 0, err
+}
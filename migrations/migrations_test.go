@@ -0,0 +1,178 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// baselineData is a database of the first release, before roles and every added column
+const baselineData = `
+INSERT INTO users (id, username) VALUES (1, 'alice'), (2, 'bobby'), (3, 'carol');
+INSERT INTO conversations (id, is_group, name) VALUES (1, 1, 'group'), (2, 0, NULL), (3, 1, 'group without admins');
+INSERT INTO conversation_participants (user_id, conversation_id, is_admin)
+VALUES (1, 1, 1), (2, 1, 1), (3, 1, 0), (1, 2, 0), (2, 2, 0), (3, 3, 0), (1, 3, 0);
+INSERT INTO messages (id, conversation_id, sender_id, content) VALUES (1, 1, 1, 'hello'), (2, 2, 2, 'hi');`
+
+func openDatabase(t *testing.T, setup ...string) *sql.DB {
+	t.Helper()
+	database, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "chat.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	for _, script := range setup {
+		if _, err = database.Exec(script); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return database
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// columns lists sorted column names of every table, added columns go last so order is ignored
+func columns(t *testing.T, database *sql.DB) map[string]string {
+	t.Helper()
+	rows, err := database.Query(`SELECT m.name, group_concat(c.name, ',')
+		FROM sqlite_master m, pragma_table_info(m.name) c WHERE m.type = 'table' GROUP BY m.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	result := map[string]string{}
+	for rows.Next() {
+		var table, names string
+		if err = rows.Scan(&table, &names); err != nil {
+			t.Fatal(err)
+		}
+		list := strings.Split(names, ",")
+		slices.Sort(list)
+		result[table] = strings.Join(list, ",")
+	}
+	return result
+}
+
+func TestApply(t *testing.T) {
+	ddl := readFile(t, "../schema.sql")
+	baseline := readFile(t, "testdata/baseline.sql")
+	tests := []struct {
+		name  string
+		setup []string
+	}{
+		{name: "new database"},
+		{name: "baseline database", setup: []string{baseline, baselineData}},
+		{name: "current database", setup: []string{ddl}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			database := openDatabase(t, tt.setup...)
+			for range 2 {
+				if err := Apply(ctx, database, ddl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var version int
+			if err := database.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+				t.Fatal(err)
+			}
+			if version != len(steps) {
+				t.Errorf("user_version = %d, want %d", version, len(steps))
+			}
+			want := columns(t, openDatabase(t, ddl))
+			got := columns(t, database)
+			for table, definition := range want {
+				if got[table] != definition {
+					t.Errorf("columns of %s = %s, want %s", table, got[table], definition)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyKeepsBaselineData(t *testing.T) {
+	ctx := context.Background()
+	database := openDatabase(t, readFile(t, "testdata/baseline.sql"), baselineData)
+	if err := Apply(ctx, database, readFile(t, "../schema.sql")); err != nil {
+		t.Fatal(err)
+	}
+	roles := map[[2]int64]string{}
+	rows, err := database.Query("SELECT user_id, conversation_id, role FROM conversation_participants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user, chat int64
+		var role string
+		if err = rows.Scan(&user, &chat, &role); err != nil {
+			t.Fatal(err)
+		}
+		roles[[2]int64{user, chat}] = role
+	}
+	want := map[[2]int64]string{{1, 1}: "owner", {2, 1}: "admin", {3, 1}: "member", {1, 2}: "member", {2, 2}: "member",
+		{3, 3}: "owner", {1, 3}: "member"}
+	for key, role := range want {
+		if roles[key] != role {
+			t.Errorf("role of user %d in chat %d = %q, want %q", key[0], key[1], roles[key], role)
+		}
+	}
+	// triggers of schema.sql work with the added columns
+	if _, err = database.Exec("UPDATE messages SET content = 'edited', edited_at = CURRENT_TIMESTAMP WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	var revisions int
+	if err = database.QueryRow("SELECT count(*) FROM message_revisions WHERE message_id = 1").Scan(&revisions); err != nil || revisions != 1 {
+		t.Errorf("revisions = %d, err %v", revisions, err)
+	}
+	// messages of deleted users stay without sender
+	if _, err = database.Exec("DELETE FROM users WHERE id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	var sender sql.NullInt64
+	if err = database.QueryRow("SELECT sender_id FROM messages WHERE id = 2").Scan(&sender); err != nil || sender.Valid {
+		t.Errorf("sender of message of deleted user = %v, err %v", sender, err)
+	}
+}
+
+func TestApplyRebuildsMessages(t *testing.T) {
+	ctx := context.Background()
+	database := openDatabase(t, readFile(t, "testdata/baseline.sql"), baselineData,
+		"INSERT INTO messages (id, conversation_id, sender_id, content) VALUES (3, 1, 3, 'deleted')",
+		"DELETE FROM messages WHERE id = 3")
+	if err := Apply(ctx, database, readFile(t, "../schema.sql")); err != nil {
+		t.Fatal(err)
+	}
+	var definition string
+	if err := database.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'messages'").Scan(&definition); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(definition, "ON DELETE SET NULL") || strings.Contains(definition, "messages_new") {
+		t.Errorf("messages table is %s", definition)
+	}
+	// ids of deleted messages aren't given again
+	var id int64
+	if err := database.QueryRow("INSERT INTO messages (conversation_id, sender_id, content) VALUES (1, 1, 'new') RETURNING id").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id != 4 {
+		t.Errorf("id of new message = %d, want 4", id)
+	}
+	var foreignKeys int
+	if err := database.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+		t.Errorf("foreign_keys = %d after migration, err %v", foreignKeys, err)
+	}
+}
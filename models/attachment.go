@@ -0,0 +1,28 @@
+package models
+
+import (
+	"awesomeProject/db"
+	"fmt"
+)
+
+// Attachment is a file of a message as it is shown to clients, URL downloads the file
+type Attachment struct {
+	ID          int64  `json:"id"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+	// Width and Height are known for images once they are processed
+	Width        int64  `json:"width,omitempty"`
+	Height       int64  `json:"height,omitempty"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+}
+
+func NewAttachment(a db.Attachment) Attachment {
+	attachment := Attachment{ID: a.ID, FileName: a.FileName, ContentType: a.ContentType, Size: a.Size,
+		URL: fmt.Sprintf("/attachments/%d", a.ID), Width: a.Width.Int64, Height: a.Height.Int64}
+	if a.ThumbnailKey.Valid {
+		attachment.ThumbnailURL = fmt.Sprintf("/attachments/%d/thumbnail", a.ID)
+	}
+	return attachment
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"awesomeProject/db"
+	"fmt"
+	"time"
+)
+
+// Chat is a conversation as it is shown to clients, AvatarURL downloads the avatar
+type Chat struct {
+	ID          int64      `json:"id"`
+	IsGroup     bool       `json:"isGroup"`
+	IsChannel   bool       `json:"isChannel"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	AvatarURL   string     `json:"avatarUrl,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+}
+
+func NewChat(c db.Conversation) Chat {
+	chat := Chat{ID: c.ID, IsGroup: c.IsGroup.Int64 == 1, IsChannel: c.IsChannel == 1, Name: c.Name.String,
+		Description: c.Description.String}
+	if c.AvatarPath.Valid {
+		chat.AvatarURL = chatAvatarURL(c.ID)
+	}
+	if c.CreatedAt.Valid {
+		chat.CreatedAt = &c.CreatedAt.Time
+	}
+	return chat
+}
+
+func chatAvatarURL(chatId int64) string {
+	return fmt.Sprintf("/chats/%d/avatar", chatId)
+}
+
+// ChatListItem is a chat in the chat list with its latest message, deleted latest message is a tombstone
+type ChatListItem struct {
+	ChatID      int64      `json:"chatId"`
+	IsGroup     bool       `json:"isGroup"`
+	IsChannel   bool       `json:"isChannel"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	AvatarURL   string     `json:"avatarUrl,omitempty"`
+	MutedUntil  *time.Time `json:"mutedUntil,omitempty"`
+	Archived    bool       `json:"archived"`
+	// PinnedOrder is set for pinned chats only, lower goes first
+	PinnedOrder *int64  `json:"pinnedOrder,omitempty"`
+	UnreadCount int64   `json:"unreadCount"`
+	LastMessage Message `json:"lastMessage"`
+}
+
+func NewChatListItem(row db.GetLatestChatsRow) ChatListItem {
+	item := ChatListItem{ChatID: row.ConversationID, IsGroup: row.IsGroup.Int64 == 1, IsChannel: row.IsChannel == 1,
+		Name: row.ChatName.String, Description: row.ChatDescription.String,
+		Archived: row.Archived == 1, UnreadCount: row.UnreadCount,
+		LastMessage: NewMessage(db.Message{ID: row.ID, ConversationID: row.ConversationID, SenderID: row.SenderID,
+			Content: row.Content, SentAt: row.SentAt, EventType: row.EventType, EventPayload: row.EventPayload,
+			ReplyToID: row.ReplyToID, EditedAt: row.EditedAt, DeletedAt: row.DeletedAt,
+			ForwardSenderID: row.ForwardSenderID, ForwardConversationID: row.ForwardConversationID})}
+	if row.ChatAvatarPath.Valid {
+		item.AvatarURL = chatAvatarURL(row.ConversationID)
+	}
+	if row.MutedUntil.Valid {
+		item.MutedUntil = &row.MutedUntil.Time
+	}
+	if row.PinnedOrder.Valid {
+		item.PinnedOrder = &row.PinnedOrder.Int64
+	}
+	return item
+}
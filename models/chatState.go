@@ -0,0 +1,11 @@
+package models
+
+type MuteChatRequest struct {
+	// DurationSeconds zero mutes the chat forever
+	DurationSeconds int64 `validate:"min=0"`
+}
+
+type PinChatRequest struct {
+	// Order zero puts the chat after already pinned ones
+	Order int64 `validate:"min=0"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type CreateGroupRequest struct {
+	Name      string  `validate:"required,max=100"`
+	MemberIds []int64 `validate:"max=200"`
+	// IsChannel creates a broadcast channel where only admins can post
+	IsChannel bool
+}
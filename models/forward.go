@@ -0,0 +1,5 @@
+package models
+
+type ForwardMessagesRequest struct {
+	MessageIds []int64 `validate:"required,min=1,max=100"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type CreateInviteRequest struct {
+	// ExpiresInSeconds zero means the invite never expires
+	ExpiresInSeconds int64 `validate:"min=0"`
+	// MaxUses zero means unlimited usage
+	MaxUses int64 `validate:"min=0"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// MemberChange is payload of realtime member.* events
+type MemberChange struct {
+	UserID  int64  `json:"userId"`
+	Role    string `json:"role,omitempty"`
+	ActorID int64  `json:"actorId"`
+}
+
+type AddMembersRequest struct {
+	UserIds []int64 `validate:"required,min=1,max=200"`
+}
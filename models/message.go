@@ -0,0 +1,94 @@
+package models
+
+import (
+	"awesomeProject/db"
+	"encoding/json"
+	"time"
+)
+
+// DeletedMessageText replaces content of deleted messages
+const DeletedMessageText = "message deleted"
+
+// PreviewLength is how many characters of the parent message are kept in a reply preview
+const PreviewLength = 100
+
+// MessagePreview is a short version of the message a reply points to
+type MessagePreview struct {
+	ID       int64  `json:"id"`
+	SenderID int64  `json:"senderId,omitempty"`
+	Content  string `json:"content"`
+}
+
+// Message is a stored message as it is sent to clients, content of deleted messages is replaced with
+// DeletedMessageText. SenderID is zero for system messages, which describe EventType in EventPayload
+type Message struct {
+	ID                    int64           `json:"id"`
+	ConversationID        int64           `json:"conversationId"`
+	SenderID              int64           `json:"senderId,omitempty"`
+	Content               string          `json:"content"`
+	SentAt                time.Time       `json:"sentAt"`
+	EventType             string          `json:"eventType,omitempty"`
+	EventPayload          json.RawMessage `json:"eventPayload,omitempty"`
+	ReplyToID             int64           `json:"replyToId,omitempty"`
+	EditedAt              *time.Time      `json:"editedAt,omitempty"`
+	DeletedAt             *time.Time      `json:"deletedAt,omitempty"`
+	ForwardSenderID       int64           `json:"forwardSenderId,omitempty"`
+	ForwardConversationID int64           `json:"forwardConversationId,omitempty"`
+}
+
+// ChatMessage is a message as it is shown in chat history
+type ChatMessage struct {
+	Message
+	ReplyTo     *MessagePreview   `json:"replyTo,omitempty"`
+	Reactions   []ReactionSummary `json:"reactions,omitempty"`
+	Pinned      bool              `json:"pinned,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+}
+
+// MessageThread is a root message with all direct and nested replies, oldest reply first
+type MessageThread struct {
+	Root       ChatMessage   `json:"root"`
+	ReplyCount int           `json:"replyCount"`
+	Replies    []ChatMessage `json:"replies"`
+}
+
+// MessageRevision is a previous text of an edited message
+type MessageRevision struct {
+	ID         int64     `json:"id"`
+	MessageID  int64     `json:"messageId"`
+	Content    string    `json:"content"`
+	WrittenAt  time.Time `json:"writtenAt"`
+	ReplacedAt time.Time `json:"replacedAt"`
+}
+
+func NewMessage(m db.Message) Message {
+	message := Message{ID: m.ID, ConversationID: m.ConversationID, SenderID: m.SenderID.Int64, Content: m.Content,
+		SentAt: m.SentAt, EventType: m.EventType.String, ReplyToID: m.ReplyToID.Int64,
+		ForwardSenderID: m.ForwardSenderID.Int64, ForwardConversationID: m.ForwardConversationID.Int64}
+	if m.EventPayload.Valid {
+		message.EventPayload = json.RawMessage(m.EventPayload.String)
+	}
+	if m.EditedAt.Valid {
+		message.EditedAt = &m.EditedAt.Time
+	}
+	if m.DeletedAt.Valid {
+		message.DeletedAt = &m.DeletedAt.Time
+		message.Content = DeletedMessageText
+	}
+	return message
+}
+
+func NewMessageRevision(r db.MessageRevision) MessageRevision {
+	return MessageRevision{ID: r.ID, MessageID: r.MessageID, Content: r.Content, WrittenAt: r.WrittenAt, ReplacedAt: r.ReplacedAt}
+}
+
+func NewMessagePreview(message db.Message) *MessagePreview {
+	if message.DeletedAt.Valid {
+		return &MessagePreview{ID: message.ID, SenderID: message.SenderID.Int64, Content: DeletedMessageText}
+	}
+	content := []rune(message.Content)
+	if len(content) > PreviewLength {
+		content = content[:PreviewLength]
+	}
+	return &MessagePreview{ID: message.ID, SenderID: message.SenderID.Int64, Content: string(content)}
+}
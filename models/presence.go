@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Presence struct {
+	UserID     int64      `json:"userId"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+type ChatMember struct {
+	UserID     int64     `json:"userId"`
+	Username   string    `json:"username"`
+	AvatarPath string    `json:"avatarPath,omitempty"`
+	Role       string    `json:"role"`
+	JoinedAt   time.Time `json:"joinedAt"`
+	Presence   Presence  `json:"presence"`
+}
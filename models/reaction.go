@@ -0,0 +1,19 @@
+package models
+
+type ReactionRequest struct {
+	Emoji string `validate:"required,max=32"`
+}
+
+// ReactionSummary is the number of reactions with one emoji, Reacted is true when the caller is among them
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// ReactionChange is payload of realtime reaction.* events
+type ReactionChange struct {
+	MessageID int64  `json:"messageId"`
+	UserID    int64  `json:"userId"`
+	Emoji     string `json:"emoji"`
+}
@@ -0,0 +1,12 @@
+package models
+
+type MessageReader struct {
+	UserID   int64  `json:"userId"`
+	Username string `json:"username"`
+}
+
+// ReadReceipt is payload of realtime message.read event
+type ReadReceipt struct {
+	UserID    int64 `json:"userId"`
+	MessageID int64 `json:"messageId"`
+}
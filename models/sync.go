@@ -0,0 +1,17 @@
+package models
+
+type Change struct {
+	ID             int64        `json:"id"`
+	Kind           string       `json:"kind"`
+	ConversationID int64        `json:"conversationId"`
+	MessageID      int64        `json:"messageId,omitempty"`
+	UserID         int64        `json:"userId,omitempty"`
+	Message        *ChatMessage `json:"message,omitempty"`
+}
+
+// SyncPage is one page of changes, Cursor is passed as since to get the next one
+type SyncPage struct {
+	Changes []Change `json:"changes"`
+	Cursor  int64    `json:"cursor"`
+	HasMore bool     `json:"hasMore"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// Event types of system messages, messages without sender describing what happened in conversation
+const (
+	SystemGroupCreated      = "group.created"
+	SystemGroupRenamed      = "group.renamed"
+	SystemGroupDescribed    = "group.description_changed"
+	SystemGroupAvatar       = "group.avatar_changed"
+	SystemMemberAdded       = "member.added"
+	SystemMemberJoined      = "member.joined"
+	SystemMemberRemoved     = "member.removed"
+	SystemMemberLeft        = "member.left"
+	SystemMemberRoleChanged = "member.role_changed"
+	SystemOwnerChanged      = "group.owner_changed"
+	SystemMessagePinned     = "message.pinned"
+	SystemMessageUnpinned   = "message.unpinned"
+)
+
+// GroupChange is payload of group.* system messages
+type GroupChange struct {
+	ActorID     int64  `json:"actorId"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// PinChange is payload of message.pinned and message.unpinned system messages
+type PinChange struct {
+	ActorID   int64 `json:"actorId"`
+	MessageID int64 `json:"messageId"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// UpdateChatRequest changes only fields which are present
+type UpdateChatRequest struct {
+	Name        *string `validate:"omitempty,max=100"`
+	Description *string `validate:"omitempty,max=500"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"awesomeProject/db"
+	"fmt"
+	"time"
+)
+
+type CreateUploadRequest struct {
+	ChatId   int64  `validate:"required"`
+	FileName string `validate:"required,max=255"`
+	Size     int64  `validate:"required,min=1"`
+}
+
+// UploadSession is state of a resumable upload, finished uploads are attached to messages by ID
+type UploadSession struct {
+	ID        string    `json:"id"`
+	ChatID    int64     `json:"chatId"`
+	FileName  string    `json:"fileName"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Finished  bool      `json:"finished"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func NewUploadSession(s db.UploadSession) UploadSession {
+	return UploadSession{ID: s.ID, ChatID: s.ConversationID, FileName: s.FileName, Size: s.Size, Offset: s.UploadOffset,
+		Finished: s.StorageKey.Valid, URL: fmt.Sprintf("/uploads/%s", s.ID), ExpiresAt: s.ExpiresAt}
+}
@@ -22,23 +22,71 @@ DELETE FROM users WHERE id = ?;
 
 -- name: ConfirmAccount :exec
 UPDATE users SET email_confirmed = 1 WHERE id = ?;
+-- name: UpdateUserLastSeen :exec
+UPDATE users SET last_seen_at = ? WHERE id = ?;
+-- name: UpdateUserHideLastSeen :exec
+UPDATE users SET hide_last_seen = ? WHERE id = ?;
+-- name: GetUsersPresence :many
+SELECT id, last_seen_at, hide_last_seen FROM users WHERE id IN (sqlc.slice('ids'));
 -- Conversations
 -- name: CreateConversation :one
-INSERT INTO conversations (is_group, name) VALUES (?, ?) RETURNING *;
+INSERT INTO conversations (is_group, name, is_channel) VALUES (?, ?, ?) RETURNING *;
 -- name: GetConversationById :one
 SELECT * FROM conversations WHERE id = ? LIMIT 1;
 -- name: DeleteConversation :exec
 DELETE FROM conversations WHERE id = ?;
 -- name: UpdateConversationName :exec
 UPDATE conversations SET name = ? WHERE id = ?;
+-- name: UpdateConversationDescription :exec
+UPDATE conversations SET description = ? WHERE id = ?;
+-- name: UpdateConversationAvatar :exec
+UPDATE conversations SET avatar_path = ? WHERE id = ?;
 -- name: CheckUserInChat :one
 SELECT EXISTS(select 1 from conversation_participants where user_id = ? and conversation_id = ?) as exist;
+-- name: GetUserConversationIds :many
+SELECT conversation_id FROM conversation_participants WHERE user_id = ?;
 -- conversation_participants
 -- name: AddParticipantsToChat :exec
-INSERT INTO conversation_participants (user_id, conversation_id, is_admin) VALUES (?, ?, ?);
+INSERT INTO conversation_participants (user_id, conversation_id, role) VALUES (?, ?, ?);
 
+-- name: GetChatMembers :many
+SELECT u.id, u.username, u.avatar_path, u.last_seen_at, u.hide_last_seen, cp.role, cp.joined_at
+FROM conversation_participants cp
+         JOIN users u on u.id = cp.user_id
+WHERE cp.conversation_id = ?
+ORDER BY cp.joined_at;
+-- name: GetParticipant :one
+SELECT * FROM conversation_participants WHERE user_id = ? and conversation_id = ? LIMIT 1;
+-- name: HideConversation :exec
+UPDATE conversation_participants
+SET hidden = 1,
+    last_read_message_id = (SELECT COALESCE(MAX(m.id), 0) FROM messages m WHERE m.conversation_id = sqlc.arg(conversation_id))
+WHERE user_id = sqlc.arg(user_id) and conversation_id = sqlc.arg(conversation_id);
+-- name: UnhideConversation :exec
+UPDATE conversation_participants SET hidden = 0 WHERE conversation_id = ? and hidden = 1;
+-- name: SetChatMutedUntil :execrows
+UPDATE conversation_participants SET muted_until = ? WHERE user_id = ? and conversation_id = ?;
+-- name: SetChatArchived :execrows
+UPDATE conversation_participants SET archived = ? WHERE user_id = ? and conversation_id = ?;
+-- name: SetChatPinnedOrder :execrows
+UPDATE conversation_participants SET pinned_order = ? WHERE user_id = ? and conversation_id = ?;
+-- name: GetMaxPinnedOrder :one
+SELECT CAST(COALESCE(MAX(pinned_order), 0) AS INTEGER) FROM conversation_participants WHERE user_id = ?;
+-- name: SetParticipantRole :exec
+UPDATE conversation_participants SET role = ? WHERE user_id = ? and conversation_id = ?;
+-- name: CountChatOwners :one
+SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ? and role = 'owner';
+-- name: CountChatParticipants :one
+SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?;
 -- name: DeleteParticipantsFromChat :exec
 DELETE FROM conversation_participants WHERE user_id = ? and conversation_id = ?;
+-- name: UpdateLastReadMessage :exec
+UPDATE conversation_participants SET last_read_message_id = MAX(last_read_message_id, CAST(sqlc.arg(message_id) AS INTEGER))
+WHERE user_id = sqlc.arg(user_id) and conversation_id = sqlc.arg(conversation_id);
+-- name: GetMessageReaders :many
+SELECT u.id, u.username FROM conversation_participants cp
+         JOIN users u on u.id = cp.user_id
+WHERE cp.conversation_id = ? and cp.last_read_message_id >= sqlc.arg(message_id) and cp.user_id != sqlc.arg(sender_id);
 -- name: CheckPrivateChatExist :one
 select c.id from conversations c
                      join conversation_participants cp on cp.conversation_id = c.id
@@ -48,27 +96,167 @@ where c.is_group = 0 and cp.user_id = ? and cp2.user_id = ?;
 
 -- Messages
 -- name: CreateMessage :one
-INSERT INTO messages (conversation_id, sender_id, content) VALUES (?, ?, ?) RETURNING *;
+INSERT INTO messages (conversation_id, sender_id, content, reply_to_id) VALUES (?, ?, ?, ?) RETURNING *;
+
+-- name: CreateForwardedMessage :one
+INSERT INTO messages (conversation_id, sender_id, content, forward_sender_id, forward_conversation_id)
+VALUES (?, ?, ?, ?, ?) RETURNING *;
+
+-- name: CreateSystemMessage :one
+INSERT INTO messages (conversation_id, content, event_type, event_payload) VALUES (?, '', ?, ?) RETURNING *;
+
+-- name: GetLastMessageId :one
+SELECT CAST(COALESCE(MAX(id), 0) AS INTEGER) as id from messages WHERE conversation_id = ?;
 
 -- name: GetMessageById :one
 SELECT * from messages WHERE id = ? LIMIT 1;
 
+-- name: GetMessagesByIds :many
+SELECT * from messages WHERE id IN (sqlc.slice('ids'));
+
+-- name: GetReplyThread :many
+-- every direct and nested reply of the root message
+WITH RECURSIVE thread(id) AS (
+    SELECT r.id FROM messages r WHERE r.reply_to_id = sqlc.arg(root_id)
+    UNION ALL
+    SELECT n.id FROM messages n JOIN thread t on n.reply_to_id = t.id
+)
+SELECT * FROM messages WHERE id IN (SELECT id FROM thread)
+  and id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = sqlc.arg(user_id))
+ORDER BY sent_at, id;
+
 -- name: DeleteMessage :exec
 DELETE FROM messages WHERE id = ?;
 
--- name: UpdateMessageText :exec
-UPDATE messages SET content = ? where id = ?;
+-- name: UpdateMessageText :one
+UPDATE messages SET content = ?, edited_at = CURRENT_TIMESTAMP where id = ? RETURNING *;
+
+-- name: SoftDeleteMessage :exec
+UPDATE messages SET content = '', event_payload = NULL, deleted_at = CURRENT_TIMESTAMP WHERE id = ? and deleted_at IS NULL;
+
+-- name: DeleteMessageRevisions :exec
+DELETE FROM message_revisions WHERE message_id = ?;
+
+-- name: DeleteMessageReactions :exec
+DELETE FROM reactions WHERE message_id = ?;
+
+-- name: PinMessage :execrows
+INSERT OR IGNORE INTO pinned_messages (message_id, conversation_id, pinned_by) VALUES (?, ?, ?);
+
+-- name: UnpinMessage :execrows
+DELETE FROM pinned_messages WHERE message_id = ?;
+
+-- name: GetPinnedMessages :many
+SELECT m.* FROM messages m
+    JOIN pinned_messages p on p.message_id = m.id
+WHERE p.conversation_id = ?
+ORDER BY p.pinned_at DESC, p.message_id DESC;
+
+-- name: GetPinnedMessageIds :many
+SELECT message_id FROM pinned_messages WHERE message_id IN (sqlc.slice('ids'));
+
+-- name: HideMessage :exec
+INSERT OR IGNORE INTO hidden_messages (message_id, user_id) VALUES (?, ?);
+
+-- name: GetMessageRevisions :many
+SELECT * FROM message_revisions WHERE message_id = ? ORDER BY id;
 
 -- name: GetMessageThread :many
-SELECT * FROM messages WHERE conversation_id = ?
-                       ORDER BY sent_at DESC
-                           LIMIT ? OFFSET ?;
+SELECT * FROM messages WHERE conversation_id = sqlc.arg(conversation_id)
+                         and id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = sqlc.arg(user_id))
+                       ORDER BY sent_at DESC, id DESC
+                           LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- Attachments
+-- name: CreateAttachment :one
+INSERT INTO attachments (message_id, storage_key, file_name, content_type, size, thumbnail_status) VALUES (?, ?, ?, ?, ?, ?) RETURNING *;
+-- name: GetAttachment :one
+SELECT a.*, m.conversation_id
+FROM attachments a
+         JOIN messages m on m.id = a.message_id
+WHERE a.id = ? LIMIT 1;
+-- name: GetMessagesAttachments :many
+SELECT * FROM attachments WHERE message_id IN (sqlc.slice('ids')) ORDER BY id;
+-- name: DeleteMessageAttachments :many
+DELETE FROM attachments WHERE message_id = ? RETURNING storage_key, thumbnail_key;
+-- name: GetConversationAttachmentKeys :many
+SELECT a.storage_key, a.thumbnail_key FROM attachments a JOIN messages m on m.id = a.message_id WHERE m.conversation_id = ?;
+-- name: GetPendingThumbnails :many
+SELECT * FROM attachments WHERE thumbnail_status = 'pending' ORDER BY id LIMIT ?;
+-- name: SetAttachmentThumbnail :execrows
+UPDATE attachments SET width = ?, height = ?, thumbnail_key = ?, thumbnail_status = ? WHERE id = ?;
+
+-- Upload sessions
+-- name: CreateUploadSession :one
+INSERT INTO upload_sessions (id, user_id, conversation_id, file_name, size, expires_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING *;
+-- name: GetUploadSession :one
+SELECT * FROM upload_sessions WHERE id = ? LIMIT 1;
+-- name: SetUploadOffset :execrows
+UPDATE upload_sessions SET upload_offset = ?, expires_at = ? WHERE id = ?;
+-- name: CompleteUploadSession :execrows
+UPDATE upload_sessions SET storage_key = ?, content_type = ? WHERE id = ?;
+-- name: DeleteUploadSession :execrows
+DELETE FROM upload_sessions WHERE id = ?;
+-- name: GetConversationUploadSessions :many
+SELECT * FROM upload_sessions WHERE conversation_id = ?;
+-- name: GetExpiredUploadSessions :many
+SELECT * FROM upload_sessions WHERE expires_at < ? ORDER BY expires_at LIMIT ?;
+
+-- Reactions
+-- name: AddReaction :execrows
+INSERT OR IGNORE INTO reactions (message_id, user_id, emoji) VALUES (?, ?, ?);
+-- name: RemoveReaction :execrows
+DELETE FROM reactions WHERE message_id = ? and user_id = ? and emoji = ?;
+-- name: GetMessagesReactions :many
+-- reactions of given messages grouped by emoji, reacted tells whether user_id is among reacted users
+SELECT message_id, emoji, COUNT(*) as count, CAST(MAX(user_id = sqlc.arg(user_id)) AS INTEGER) as reacted
+FROM reactions
+WHERE message_id IN (sqlc.slice('ids'))
+GROUP BY message_id, emoji
+ORDER BY MIN(created_at), emoji;
 
 -- name: GetLatestChats :many
-select m.* from messages m
-                    JOIN (SELECT conversation_id, MAX(sent_at) as last_sent
-                          from messages GROUP BY conversation_id) latest on m.conversation_id = latest.conversation_id
-    and m.sent_at = latest.last_sent
+select m.*, c.is_group, c.is_channel, c.name as chat_name, c.description as chat_description, c.avatar_path as chat_avatar_path,
+       cp.muted_until, cp.archived, cp.pinned_order,
+       (SELECT COUNT(*) FROM messages um
+        WHERE um.conversation_id = m.conversation_id and um.id > cp.last_read_message_id
+          and (um.sender_id IS NULL or um.sender_id != cp.user_id) and um.deleted_at IS NULL
+          and um.id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = cp.user_id)) as unread_count
+from messages m
                     JOIN conversation_participants cp on cp.conversation_id = m.conversation_id
-where cp.user_id = ?
-order by m.sent_at desc;
+                    JOIN conversations c on c.id = m.conversation_id
+where cp.user_id = sqlc.arg(user_id) and cp.hidden = 0
+  and (cp.archived = 0 or cp.archived = sqlc.arg(archived))
+  -- the latest visible message, when there is none the latest deleted or hidden one so the chat is still listed
+  and m.id = (SELECT lm.id FROM messages lm
+                        LEFT JOIN hidden_messages hm on hm.message_id = lm.id and hm.user_id = cp.user_id
+              WHERE lm.conversation_id = m.conversation_id
+              ORDER BY hm.message_id IS NOT NULL, lm.deleted_at IS NOT NULL, lm.id DESC
+              LIMIT 1)
+order by cp.pinned_order IS NULL, cp.pinned_order, m.sent_at desc;
+
+-- Invites
+-- name: CreateInvite :one
+INSERT INTO invites (code, conversation_id, created_by, expires_at, max_uses) VALUES (?, ?, ?, ?, ?) RETURNING *;
+-- name: GetInviteByCode :one
+SELECT * FROM invites WHERE code = ? LIMIT 1;
+-- name: GetChatInvites :many
+SELECT * FROM invites WHERE conversation_id = ? and revoked = 0 ORDER BY id DESC;
+-- name: RevokeInvite :exec
+UPDATE invites SET revoked = 1 WHERE id = ?;
+-- name: UseInvite :execrows
+UPDATE invites SET uses = uses + 1 WHERE id = ? and revoked = 0 and (max_uses IS NULL or uses < max_uses);
+
+-- Sync
+-- name: GetChangesSince :many
+SELECT c.id, c.conversation_id, c.kind, c.message_id, c.user_id, c.created_at,
+       m.sender_id, m.content, m.sent_at, m.event_type, m.event_payload, m.reply_to_id, m.edited_at, m.deleted_at,
+       m.forward_sender_id, m.forward_conversation_id
+from changes c
+         LEFT JOIN messages m on m.id = c.message_id
+where c.id > sqlc.arg(since)
+  and (c.conversation_id IN (SELECT cp.conversation_id FROM conversation_participants cp WHERE cp.user_id = sqlc.arg(user_id))
+    or (c.user_id = sqlc.arg(user_id) and c.kind LIKE 'member.%'))
+  and (c.message_id IS NULL or c.message_id NOT IN (SELECT message_id FROM hidden_messages WHERE user_id = sqlc.arg(user_id)))
+order by c.id
+LIMIT sqlc.arg(limit);
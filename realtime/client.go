@@ -0,0 +1,15 @@
+package realtime
+
+const sendBufferSize = 64
+
+// Client is a single realtime connection of a user, transport agnostic.
+// Hub writes events to Send, the transport drains it.
+type Client struct {
+	UserID int64
+	Send   chan Event
+	rooms  map[int64]struct{}
+}
+
+func NewClient(userId int64) *Client {
+	return &Client{UserID: userId, Send: make(chan Event, sendBufferSize), rooms: map[int64]struct{}{}}
+}
@@ -0,0 +1,45 @@
+package realtime
+
+const (
+	MessageCreated = "message.created"
+	MessageUpdated = "message.updated"
+	MessageDeleted = "message.deleted"
+	// ConversationCreated and ConversationUpdated payload is models.Chat
+	ConversationCreated = "conversation.created"
+	ConversationUpdated = "conversation.updated"
+	ConversationDeleted = "conversation.deleted"
+	// Member events payload is models.MemberChange
+	MemberAdded   = "member.added"
+	MemberUpdated = "member.updated"
+	MemberRemoved = "member.removed"
+	// Reaction events payload is models.ReactionChange
+	ReactionAdded   = "reaction.added"
+	ReactionRemoved = "reaction.removed"
+	// AttachmentUpdated payload is models.Attachment, sent when its thumbnail is ready
+	AttachmentUpdated = "attachment.updated"
+	// MessageRead payload is models.ReadReceipt
+	MessageRead   = "message.read"
+	TypingStarted = "typing.started"
+	TypingStopped = "typing.stopped"
+	// PresenceChanged payload is models.Presence
+	PresenceChanged = "presence.changed"
+	// Resync tells the client that missed events can't be replayed and it has to refetch state
+	Resync = "resync"
+)
+
+// Event is the JSON envelope pushed to connected clients
+type Event struct {
+	ID             int64  `json:"id,omitempty"`
+	Type           string `json:"type"`
+	ConversationID int64  `json:"conversationId"`
+	Payload        any    `json:"payload"`
+}
+
+type MessageDeletedPayload struct {
+	MessageID int64 `json:"messageId"`
+}
+
+type TypingPayload struct {
+	UserID         int64 `json:"userId"`
+	TimeoutSeconds int   `json:"timeoutSeconds,omitempty"`
+}
@@ -0,0 +1,168 @@
+package realtime
+
+import "sync"
+
+// historySize is how many recent events are kept for Last-Event-ID resume
+const historySize = 1024
+
+// Hub keeps connected clients grouped by conversation (room) and by user
+type Hub struct {
+	mu      sync.RWMutex
+	rooms   map[int64]map[*Client]struct{}
+	users   map[int64]map[*Client]struct{}
+	lastId  int64
+	history []Event
+}
+
+func NewHub() *Hub {
+	return &Hub{rooms: map[int64]map[*Client]struct{}{}, users: map[int64]map[*Client]struct{}{}}
+}
+
+// Register adds client to the hub and subscribes it to given conversations
+func (h *Hub) Register(c *Client, conversationIds []int64) {
+	h.Resume(c, conversationIds, 0)
+}
+
+// Resume registers client like Register and returns events of its conversations
+// published after lastEventId, so reconnecting client doesn't miss anything.
+// When the gap can't be filled from history a single Resync event is returned.
+func (h *Hub) Resume(c *Client, conversationIds []int64, lastEventId int64) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registerLocked(c, conversationIds)
+	if lastEventId <= 0 || lastEventId == h.lastId {
+		return nil
+	}
+	if lastEventId > h.lastId || len(h.history) == 0 || h.history[0].ID > lastEventId+1 {
+		return []Event{{ID: h.lastId, Type: Resync}}
+	}
+	var missed []Event
+	for _, e := range h.history {
+		if _, ok := c.rooms[e.ConversationID]; ok && e.ID > lastEventId {
+			missed = append(missed, e)
+		}
+	}
+	return missed
+}
+
+func (h *Hub) registerLocked(c *Client, conversationIds []int64) {
+	if h.users[c.UserID] == nil {
+		h.users[c.UserID] = map[*Client]struct{}{}
+	}
+	h.users[c.UserID][c] = struct{}{}
+	for _, id := range conversationIds {
+		h.joinLocked(c, id)
+	}
+}
+
+// Unregister removes client from all rooms and closes its Send channel
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(c)
+}
+
+// Join subscribes every connection of the user to the conversation
+func (h *Hub) Join(userId, conversationId int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.users[userId] {
+		h.joinLocked(c, conversationId)
+	}
+}
+
+// Leave unsubscribes every connection of the user from the conversation
+func (h *Hub) Leave(userId, conversationId int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.users[userId] {
+		h.leaveLocked(c, conversationId)
+	}
+}
+
+// Connections returns number of live connections of the user
+func (h *Hub) Connections(userId int64) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.users[userId])
+}
+
+// Publish assigns event an id and sends it to every client subscribed to the
+// conversation. Clients which can't keep up are disconnected.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastId++
+	event.ID = h.lastId
+	h.history = append(h.history, event)
+	if len(h.history) > historySize {
+		h.history = h.history[len(h.history)-historySize:]
+	}
+	for c := range h.rooms[event.ConversationID] {
+		select {
+		case c.Send <- event:
+		default:
+			h.removeLocked(c)
+		}
+	}
+}
+
+// Notify sends ephemeral event to the conversation except clients of exceptUserId.
+// Ephemeral events get no id and aren't replayed on resume.
+func (h *Hub) Notify(event Event, exceptUserId int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.rooms[event.ConversationID] {
+		if c.UserID == exceptUserId {
+			continue
+		}
+		select {
+		case c.Send <- event:
+		default:
+			h.removeLocked(c)
+		}
+	}
+}
+
+// CloseRoom unsubscribes every client from the conversation, used when it is deleted
+func (h *Hub) CloseRoom(conversationId int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.rooms[conversationId] {
+		h.leaveLocked(c, conversationId)
+	}
+}
+
+func (h *Hub) joinLocked(c *Client, conversationId int64) {
+	if h.rooms[conversationId] == nil {
+		h.rooms[conversationId] = map[*Client]struct{}{}
+	}
+	h.rooms[conversationId][c] = struct{}{}
+	c.rooms[conversationId] = struct{}{}
+}
+
+func (h *Hub) leaveLocked(c *Client, conversationId int64) {
+	delete(h.rooms[conversationId], c)
+	if len(h.rooms[conversationId]) == 0 {
+		delete(h.rooms, conversationId)
+	}
+	delete(c.rooms, conversationId)
+}
+
+func (h *Hub) removeLocked(c *Client) {
+	clients, ok := h.users[c.UserID]
+	if !ok {
+		return
+	}
+	if _, ok = clients[c]; !ok {
+		return
+	}
+	for id := range c.rooms {
+		h.leaveLocked(c, id)
+	}
+	delete(clients, c)
+	if len(clients) == 0 {
+		delete(h.users, c.UserID)
+	}
+	close(c.Send)
+}
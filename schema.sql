@@ -7,7 +7,9 @@ CREATE TABLE IF NOT EXISTS users (
     email_normalized TEXT UNIQUER,
     email_confirmed INTEGER NOT NULL CHECK (email_confirmed in (0, 1)) DEFAULT 0,
     avatar_path TEXT,
-                                    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+                                    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP,
+    hide_last_seen INTEGER NOT NULL CHECK (hide_last_seen in (0, 1)) DEFAULT 0
 );
 CREATE UNIQUE INDEX IF NOT EXISTS idx_username ON users(LOWER(username_normalized));
 CREATE UNIQUE INDEX IF NOT EXISTS idx_email ON users(LOWER(email_normalized));
@@ -15,20 +17,189 @@ CREATE TABLE IF NOT EXISTS conversations (
     id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
     is_group INTEGER CHECK (is_group in (0, 1)),
     name TEXT,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    description TEXT,
+    avatar_path TEXT,
+    is_channel INTEGER NOT NULL CHECK (is_channel in (0, 1)) DEFAULT 0
 );
 CREATE TABLE IF NOT EXISTS conversation_participants(
     id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
     joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    is_admin INTEGER CHECK (is_admin in (0, 1)) DEFAULT 0,
+    role TEXT NOT NULL CHECK (role in ('owner', 'admin', 'member', 'readonly')) DEFAULT 'member',
+    last_read_message_id INTEGER NOT NULL DEFAULT 0,
+    -- hidden conversations are left out of the chat list of this participant
+    hidden INTEGER NOT NULL CHECK (hidden in (0, 1)) DEFAULT 0,
+    muted_until TIMESTAMP,
+    archived INTEGER NOT NULL CHECK (archived in (0, 1)) DEFAULT 0,
+    -- pinned_order is NULL for chats which aren't pinned, lower goes first
+    pinned_order INTEGER,
     UNIQUE (user_id, conversation_id)
 );
 CREATE TABLE IF NOT EXISTS messages(
     id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT ,
     conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
-    sender_id INTEGER REFERENCES users(id),
+    sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
     content TEXT NOT NULL,
-    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- system messages have no sender, event_payload is JSON
+    event_type TEXT,
+    event_payload TEXT,
+    reply_to_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+    edited_at TIMESTAMP,
+    -- deleted messages stay as tombstones with erased content
+    deleted_at TIMESTAMP,
+    -- forwarded messages keep the original sender and conversation
+    forward_sender_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    forward_conversation_id INTEGER REFERENCES conversations(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_messages_reply ON messages(reply_to_id);
+-- message_revisions keeps every previous version of edited messages, written_at is when the version was created
+CREATE TABLE IF NOT EXISTS message_revisions(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    written_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_message_revisions_message ON message_revisions(message_id, id);
+CREATE TABLE IF NOT EXISTS pinned_messages(
+    message_id INTEGER NOT NULL PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    pinned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_conversation ON pinned_messages(conversation_id, pinned_at);
+-- hidden_messages are messages deleted only for one user
+CREATE TABLE IF NOT EXISTS hidden_messages(
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, message_id)
+);
+-- attachments are files of a message, the file itself is in storage under storage_key
+CREATE TABLE IF NOT EXISTS attachments(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    storage_key TEXT NOT NULL UNIQUE,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- images get dimensions and a downscaled thumbnail from the background worker
+    width INTEGER,
+    height INTEGER,
+    thumbnail_key TEXT,
+    thumbnail_status TEXT NOT NULL CHECK (thumbnail_status in ('none', 'pending', 'ready', 'failed')) DEFAULT 'none'
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_thumbnail_status ON attachments(thumbnail_status);
+-- upload_sessions are resumable uploads of one file, received bytes are appended to a partial file until
+-- upload_offset reaches size. Finished uploads get storage_key and wait to be attached to a message
+CREATE TABLE IF NOT EXISTS upload_sessions(
+    id TEXT NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    file_name TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    upload_offset INTEGER NOT NULL DEFAULT 0,
+    storage_key TEXT,
+    content_type TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires ON upload_sessions(expires_at);
+CREATE TABLE IF NOT EXISTS reactions(
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+CREATE TABLE IF NOT EXISTS invites(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP,
+    max_uses INTEGER,
+    uses INTEGER NOT NULL DEFAULT 0,
+    revoked INTEGER NOT NULL CHECK (revoked in (0, 1)) DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- changes is append only log of everything clients have to catch up on, filled by triggers.
+-- Its id is the cursor of GET /sync
+CREATE TABLE IF NOT EXISTS changes(
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    conversation_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    message_id INTEGER,
+    user_id INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
+CREATE INDEX IF NOT EXISTS idx_changes_conversation ON changes(conversation_id, id);
+CREATE INDEX IF NOT EXISTS idx_changes_user ON changes(user_id, id);
+CREATE TRIGGER IF NOT EXISTS trg_message_created AFTER INSERT ON messages
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id) VALUES (NEW.conversation_id, 'message.created', NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_updated AFTER UPDATE OF content ON messages
+    WHEN NEW.deleted_at IS NULL
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id) VALUES (NEW.conversation_id, 'message.updated', NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_revision AFTER UPDATE OF content ON messages
+    WHEN OLD.content IS NOT NEW.content and NEW.deleted_at IS NULL
+BEGIN
+    INSERT INTO message_revisions (message_id, content, written_at)
+    VALUES (OLD.id, OLD.content, COALESCE(OLD.edited_at, OLD.sent_at));
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_deleted AFTER DELETE ON messages
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id) VALUES (OLD.conversation_id, 'message.deleted', OLD.id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_soft_deleted AFTER UPDATE OF deleted_at ON messages
+    WHEN OLD.deleted_at IS NULL and NEW.deleted_at IS NOT NULL
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id) VALUES (NEW.conversation_id, 'message.deleted', NEW.id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_member_added AFTER INSERT ON conversation_participants
+BEGIN
+    INSERT INTO changes (conversation_id, kind, user_id) VALUES (NEW.conversation_id, 'member.added', NEW.user_id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_member_updated AFTER UPDATE OF role ON conversation_participants
+BEGIN
+    INSERT INTO changes (conversation_id, kind, user_id) VALUES (NEW.conversation_id, 'member.updated', NEW.user_id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_member_removed AFTER DELETE ON conversation_participants
+BEGIN
+    INSERT INTO changes (conversation_id, kind, user_id) VALUES (OLD.conversation_id, 'member.removed', OLD.user_id);
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_read AFTER UPDATE OF last_read_message_id ON conversation_participants
+    WHEN NEW.last_read_message_id > OLD.last_read_message_id
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id, user_id)
+    VALUES (NEW.conversation_id, 'message.read', NEW.last_read_message_id, NEW.user_id);
+END;
+-- reactions and pins are logged only while their message is there, removals cascading from a deleted
+-- message are covered by message.deleted
+CREATE TRIGGER IF NOT EXISTS trg_reaction_added AFTER INSERT ON reactions
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id, user_id)
+    SELECT conversation_id, 'reaction.added', id, NEW.user_id FROM messages WHERE id = NEW.message_id and deleted_at IS NULL;
+END;
+CREATE TRIGGER IF NOT EXISTS trg_reaction_removed AFTER DELETE ON reactions
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id, user_id)
+    SELECT conversation_id, 'reaction.removed', id, OLD.user_id FROM messages WHERE id = OLD.message_id and deleted_at IS NULL;
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_pinned AFTER INSERT ON pinned_messages
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id, user_id)
+    SELECT conversation_id, 'message.pinned', id, NEW.pinned_by FROM messages WHERE id = NEW.message_id and deleted_at IS NULL;
+END;
+CREATE TRIGGER IF NOT EXISTS trg_message_unpinned AFTER DELETE ON pinned_messages
+BEGIN
+    INSERT INTO changes (conversation_id, kind, message_id)
+    SELECT conversation_id, 'message.unpinned', id FROM messages WHERE id = OLD.message_id and deleted_at IS NULL;
+END;
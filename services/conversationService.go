@@ -0,0 +1,669 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/realtime"
+	"awesomeProject/storage"
+	"awesomeProject/types"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gabriel-vasile/mimetype"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+type ConversationService struct {
+	Queries  *db.Queries
+	Database *sql.DB
+	Hub      *realtime.Hub
+	Presence *PresenceService
+	Files    storage.Storage
+	Uploads  *UploadService
+}
+
+func NewConversationService(queries *db.Queries, database *sql.DB, hub *realtime.Hub, presence *PresenceService,
+	files storage.Storage, uploads *UploadService) *ConversationService {
+	return &ConversationService{queries, database, hub, presence, files, uploads}
+}
+
+func (s *ConversationService) GetMembers(ctx context.Context, chatId, userId int64) ([]models.ChatMember, *types.StatusError) {
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	rows, err := s.Queries.GetChatMembers(ctx, chatId)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	members := make([]models.ChatMember, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, models.ChatMember{
+			UserID:     row.ID,
+			Username:   row.Username.String,
+			AvatarPath: row.AvatarPath.String,
+			Role:       row.Role,
+			JoinedAt:   row.JoinedAt.Time,
+			Presence:   s.Presence.Presence(row.ID, row.LastSeenAt, row.HideLastSeen == 1),
+		})
+	}
+	return members, nil
+}
+
+// CreateGroup creates named group chat, creator becomes its owner
+func (s *ConversationService) CreateGroup(ctx context.Context, userId int64, name string, memberIds []int64, isChannel bool) (*models.Chat, *types.StatusError) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, &types.StatusError{Err: errors.New("group name must not be empty"), Status: http.StatusBadRequest}
+	}
+	members := make([]int64, 0, len(memberIds))
+	seen := map[int64]bool{userId: true}
+	for _, id := range memberIds {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res, err := s.Queries.CheckUserExist(ctx, id)
+		if err != nil {
+			return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if res == 0 {
+			return nil, &types.StatusError{Err: fmt.Errorf("user %d not found", id), Status: http.StatusNotFound}
+		}
+		members = append(members, id)
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	var channel int64
+	if isChannel {
+		channel = 1
+	}
+	cv, err := q.CreateConversation(ctx, db.CreateConversationParams{IsGroup: sql.NullInt64{Int64: 1, Valid: true},
+		Name: sql.NullString{String: name, Valid: true}, IsChannel: channel})
+	if err != nil {
+		return nil, rollbackOnError(tx, err)
+	}
+	err = q.AddParticipantsToChat(ctx, db.AddParticipantsToChatParams{UserID: userId, ConversationID: cv.ID, Role: RoleOwner})
+	if err != nil {
+		return nil, rollbackOnError(tx, err)
+	}
+	for _, id := range members {
+		err = q.AddParticipantsToChat(ctx, db.AddParticipantsToChatParams{UserID: id, ConversationID: cv.ID, Role: RoleMember})
+		if err != nil {
+			return nil, rollbackOnError(tx, err)
+		}
+	}
+	message, err := createSystemMessage(ctx, q, cv.ID, models.SystemGroupCreated, models.GroupChange{ActorID: userId, Name: name})
+	if err != nil {
+		return nil, rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	for _, id := range append(members, userId) {
+		s.Hub.Join(id, cv.ID)
+	}
+	chat := models.NewChat(cv)
+	s.Hub.Publish(realtime.Event{Type: realtime.ConversationCreated, ConversationID: cv.ID, Payload: chat})
+	s.publishMessage(message)
+	return &chat, nil
+}
+
+// requireGroupPermission checks that chat is a group and the role of user allows the action
+func (s *ConversationService) requireGroupPermission(ctx context.Context, chatId, userId int64, permission Permission) (*db.ConversationParticipant, *types.StatusError) {
+	if statErr := s.requireGroup(ctx, chatId); statErr != nil {
+		return nil, statErr
+	}
+	return checkPermission(ctx, s.Queries, chatId, userId, permission)
+}
+
+// requireGroup rejects membership changes of private chats
+func (s *ConversationService) requireGroup(ctx context.Context, chatId int64) *types.StatusError {
+	chat, err := s.Queries.GetConversationById(ctx, chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.StatusError{Err: errors.New("chat not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if chat.IsGroup.Int64 != 1 {
+		return &types.StatusError{Err: errors.New("members of private chat can't be changed"), Status: http.StatusBadRequest}
+	}
+	return nil
+}
+
+func (s *ConversationService) AddMembers(ctx context.Context, chatId, userId int64, memberIds []int64) *types.StatusError {
+	if _, statErr := s.requireGroupPermission(ctx, chatId, userId, PermissionManageMembers); statErr != nil {
+		return statErr
+	}
+	var added []int64
+	seen := map[int64]bool{}
+	for _, id := range memberIds {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res, err := s.Queries.CheckUserExist(ctx, id)
+		if err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if res == 0 {
+			return &types.StatusError{Err: fmt.Errorf("user %d not found", id), Status: http.StatusNotFound}
+		}
+		res, err = s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: id, ConversationID: chatId})
+		if err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if res == 0 {
+			added = append(added, id)
+		}
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	messages := make([]db.Message, 0, len(added))
+	for _, id := range added {
+		err = q.AddParticipantsToChat(ctx, db.AddParticipantsToChatParams{UserID: id, ConversationID: chatId, Role: RoleMember})
+		if err != nil {
+			return rollbackOnError(tx, err)
+		}
+		message, err := createSystemMessage(ctx, q, chatId, models.SystemMemberAdded, models.MemberChange{UserID: id, ActorID: userId})
+		if err != nil {
+			return rollbackOnError(tx, err)
+		}
+		messages = append(messages, message)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	for i, id := range added {
+		s.Hub.Join(id, chatId)
+		s.Hub.Publish(realtime.Event{Type: realtime.MemberAdded, ConversationID: chatId,
+			Payload: models.MemberChange{UserID: id, ActorID: userId}})
+		s.publishMessage(messages[i])
+	}
+	return nil
+}
+
+func (s *ConversationService) RemoveMember(ctx context.Context, chatId, userId, memberId int64) *types.StatusError {
+	if memberId == userId {
+		return s.Leave(ctx, chatId, userId)
+	}
+	actor, statErr := s.requireGroupPermission(ctx, chatId, userId, PermissionManageMembers)
+	if statErr != nil {
+		return statErr
+	}
+	member, statErr := s.getMember(ctx, chatId, memberId)
+	if statErr != nil {
+		return statErr
+	}
+	if !outranks(actor.Role, member.Role) {
+		return &types.StatusError{Err: errors.New("can't remove member with the same or higher role"), Status: http.StatusForbidden}
+	}
+	change := models.MemberChange{UserID: memberId, ActorID: userId}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	err = q.DeleteParticipantsFromChat(ctx, db.DeleteParticipantsFromChatParams{UserID: memberId, ConversationID: chatId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	message, err := createSystemMessage(ctx, q, chatId, models.SystemMemberRemoved, change)
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.MemberRemoved, ConversationID: chatId, Payload: change})
+	s.Hub.Leave(memberId, chatId)
+	s.publishMessage(message)
+	return nil
+}
+
+// SetRole changes role of group member. Nobody can change own role or role of
+// a member with the same or higher role, owners appear only by ownership transfer.
+func (s *ConversationService) SetRole(ctx context.Context, chatId, userId, memberId int64, role string) *types.StatusError {
+	if !IsValidRole(role) || role == RoleOwner {
+		return &types.StatusError{Err: fmt.Errorf("role must be one of %s, %s, %s", RoleAdmin, RoleMember, RoleReadOnly),
+			Status: http.StatusBadRequest}
+	}
+	permission := PermissionManageMembers
+	if role == RoleAdmin {
+		permission = PermissionManageAdmins
+	}
+	actor, statErr := s.requireGroupPermission(ctx, chatId, userId, permission)
+	if statErr != nil {
+		return statErr
+	}
+	member, statErr := s.getMember(ctx, chatId, memberId)
+	if statErr != nil {
+		return statErr
+	}
+	if memberId == userId || !outranks(actor.Role, member.Role) {
+		return &types.StatusError{Err: errors.New("can't change role of member with the same or higher role"), Status: http.StatusForbidden}
+	}
+	if member.Role == role {
+		return nil
+	}
+	change := models.MemberChange{UserID: memberId, Role: role, ActorID: userId}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	err = q.SetParticipantRole(ctx, db.SetParticipantRoleParams{Role: role, UserID: memberId, ConversationID: chatId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	message, err := createSystemMessage(ctx, q, chatId, models.SystemMemberRoleChanged, change)
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.MemberUpdated, ConversationID: chatId, Payload: change})
+	s.publishMessage(message)
+	return nil
+}
+
+// TransferOwnership makes member the owner of the group, previous owner becomes admin
+func (s *ConversationService) TransferOwnership(ctx context.Context, chatId, userId, memberId int64) *types.StatusError {
+	if _, statErr := s.requireGroupPermission(ctx, chatId, userId, PermissionManageAdmins); statErr != nil {
+		return statErr
+	}
+	if memberId == userId {
+		return &types.StatusError{Err: errors.New("user already owns the group"), Status: http.StatusBadRequest}
+	}
+	if _, statErr := s.getMember(ctx, chatId, memberId); statErr != nil {
+		return statErr
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	err = q.SetParticipantRole(ctx, db.SetParticipantRoleParams{Role: RoleOwner, UserID: memberId, ConversationID: chatId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	err = q.SetParticipantRole(ctx, db.SetParticipantRoleParams{Role: RoleAdmin, UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	message, err := createSystemMessage(ctx, q, chatId, models.SystemOwnerChanged,
+		models.MemberChange{UserID: memberId, Role: RoleOwner, ActorID: userId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.MemberUpdated, ConversationID: chatId,
+		Payload: models.MemberChange{UserID: memberId, Role: RoleOwner, ActorID: userId}})
+	s.Hub.Publish(realtime.Event{Type: realtime.MemberUpdated, ConversationID: chatId,
+		Payload: models.MemberChange{UserID: userId, Role: RoleAdmin, ActorID: userId}})
+	s.publishMessage(message)
+	return nil
+}
+
+// Leave removes user from the group. The last owner has to transfer ownership first,
+// group without members is deleted.
+func (s *ConversationService) Leave(ctx context.Context, chatId, userId int64) *types.StatusError {
+	if statErr := s.requireGroup(ctx, chatId); statErr != nil {
+		return statErr
+	}
+	member, statErr := s.getMember(ctx, chatId, userId)
+	if statErr != nil {
+		return statErr
+	}
+	count, err := s.Queries.CountChatParticipants(ctx, chatId)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if count == 1 {
+		return s.deleteConversation(ctx, chatId, userId)
+	}
+	if member.Role == RoleOwner {
+		owners, err := s.Queries.CountChatOwners(ctx, chatId)
+		if err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if owners <= 1 {
+			return &types.StatusError{Err: errors.New("the last owner must transfer ownership before leaving"), Status: http.StatusConflict}
+		}
+	}
+	change := models.MemberChange{UserID: userId, ActorID: userId}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	err = q.DeleteParticipantsFromChat(ctx, db.DeleteParticipantsFromChatParams{UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	message, err := createSystemMessage(ctx, q, chatId, models.SystemMemberLeft, change)
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.MemberRemoved, ConversationID: chatId, Payload: change})
+	s.Hub.Leave(userId, chatId)
+	s.publishMessage(message)
+	return nil
+}
+
+// Hide removes the chat from the chat list of the user only, it comes back with new messages
+func (s *ConversationService) Hide(ctx context.Context, chatId, userId int64) *types.StatusError {
+	if _, statErr := checkPermission(ctx, s.Queries, chatId, userId, PermissionRead); statErr != nil {
+		return statErr
+	}
+	if err := s.Queries.HideConversation(ctx, db.HideConversationParams{ConversationID: chatId, UserID: userId}); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// Delete removes the group for everyone, participants, messages and invites go with it
+func (s *ConversationService) Delete(ctx context.Context, chatId, userId int64) *types.StatusError {
+	if _, statErr := s.requireGroupPermission(ctx, chatId, userId, PermissionDeleteChat); statErr != nil {
+		return statErr
+	}
+	return s.deleteConversation(ctx, chatId, userId)
+}
+
+// deleteConversation removes the conversation with its rows, notifies its members and closes its room,
+// then removes files of its attachments, uploads and avatar
+func (s *ConversationService) deleteConversation(ctx context.Context, chatId, actorId int64) *types.StatusError {
+	chat, err := s.Queries.GetConversationById(ctx, chatId)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	attachments, err := q.GetConversationAttachmentKeys(ctx, chatId)
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	// upload sessions go away with the conversation, their files have to be collected before
+	uploads, err := q.GetConversationUploadSessions(ctx, chatId)
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = q.DeleteConversation(ctx, chatId); err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.ConversationDeleted, ConversationID: chatId, Payload: models.GroupChange{ActorID: actorId}})
+	s.Hub.CloseRoom(chatId)
+	for _, a := range attachments {
+		keys := []string{a.StorageKey}
+		if a.ThumbnailKey.Valid {
+			keys = append(keys, a.ThumbnailKey.String)
+		}
+		for _, key := range keys {
+			if err = s.Files.Delete(ctx, key); err != nil {
+				log.Printf("delete file %s of deleted chat %d: %v", key, chatId, err)
+			}
+		}
+	}
+	for _, session := range uploads {
+		s.Uploads.removeFiles(ctx, session)
+	}
+	s.removeAvatar(ctx, chat.AvatarPath)
+	return nil
+}
+
+func (s *ConversationService) getMember(ctx context.Context, chatId, memberId int64) (*db.ConversationParticipant, *types.StatusError) {
+	member, err := s.Queries.GetParticipant(ctx, db.GetParticipantParams{UserID: memberId, ConversationID: chatId})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("member not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return &member, nil
+}
+
+// publishMessage sends system message in the shape of chat history, system messages have no replies,
+// reactions or attachments
+func (s *ConversationService) publishMessage(message db.Message) {
+	s.Hub.Publish(realtime.Event{Type: realtime.MessageCreated, ConversationID: message.ConversationID,
+		Payload: models.ChatMessage{Message: models.NewMessage(message)}})
+}
+
+// createSystemMessage stores message without sender which describes conversation event
+func createSystemMessage(ctx context.Context, q *db.Queries, chatId int64, eventType string, payload any) (db.Message, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return db.Message{}, err
+	}
+	return q.CreateSystemMessage(ctx, db.CreateSystemMessageParams{ConversationID: chatId,
+		EventType: sql.NullString{String: eventType, Valid: true}, EventPayload: sql.NullString{String: string(data), Valid: true}})
+}
+
+// MaxAvatarSize limits size of uploaded conversation avatar
+const MaxAvatarSize = 5 << 20
+
+var avatarTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true, "image/webp": true}
+
+// UpdateChat changes group name and description, only admins can do it
+func (s *ConversationService) UpdateChat(ctx context.Context, chatId, userId int64, request models.UpdateChatRequest) (*models.Chat, *types.StatusError) {
+	if _, statErr := s.requireGroupPermission(ctx, chatId, userId, PermissionManageChat); statErr != nil {
+		return nil, statErr
+	}
+	if request.Name != nil && strings.TrimSpace(*request.Name) == "" {
+		return nil, &types.StatusError{Err: errors.New("group name must not be empty"), Status: http.StatusBadRequest}
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	var messages []db.Message
+	if request.Name != nil {
+		name := strings.TrimSpace(*request.Name)
+		err = q.UpdateConversationName(ctx, db.UpdateConversationNameParams{Name: sql.NullString{String: name, Valid: true}, ID: chatId})
+		if err != nil {
+			return nil, rollbackOnError(tx, err)
+		}
+		message, err := createSystemMessage(ctx, q, chatId, models.SystemGroupRenamed, models.GroupChange{ActorID: userId, Name: name})
+		if err != nil {
+			return nil, rollbackOnError(tx, err)
+		}
+		messages = append(messages, message)
+	}
+	if request.Description != nil {
+		description := strings.TrimSpace(*request.Description)
+		err = q.UpdateConversationDescription(ctx, db.UpdateConversationDescriptionParams{
+			Description: sql.NullString{String: description, Valid: description != ""}, ID: chatId})
+		if err != nil {
+			return nil, rollbackOnError(tx, err)
+		}
+		message, err := createSystemMessage(ctx, q, chatId, models.SystemGroupDescribed,
+			models.GroupChange{ActorID: userId, Description: description})
+		if err != nil {
+			return nil, rollbackOnError(tx, err)
+		}
+		messages = append(messages, message)
+	}
+	chat, err := q.GetConversationById(ctx, chatId)
+	if err != nil {
+		return nil, rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	result := models.NewChat(chat)
+	s.Hub.Publish(realtime.Event{Type: realtime.ConversationUpdated, ConversationID: chatId, Payload: result})
+	for _, message := range messages {
+		s.publishMessage(message)
+	}
+	return &result, nil
+}
+
+// SetAvatar stores new group avatar image, previous one is removed. Empty data removes avatar.
+func (s *ConversationService) SetAvatar(ctx context.Context, chatId, userId int64, data []byte) (*models.Chat, *types.StatusError) {
+	if _, statErr := s.requireGroupPermission(ctx, chatId, userId, PermissionManageChat); statErr != nil {
+		return nil, statErr
+	}
+	chat, err := s.Queries.GetConversationById(ctx, chatId)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	var avatarPath sql.NullString
+	if len(data) > 0 {
+		mime := mimetype.Detect(data)
+		if !avatarTypes[mime.String()] {
+			return nil, &types.StatusError{Err: fmt.Errorf("unsupported avatar type %s", mime.String()), Status: http.StatusUnsupportedMediaType}
+		}
+		code, err := randomCode()
+		if err != nil {
+			return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		avatarPath = sql.NullString{String: fmt.Sprintf("avatars/chat_%d_%s%s", chatId, code, mime.Extension()), Valid: true}
+		if err = s.Files.Put(ctx, avatarPath.String, bytes.NewReader(data)); err != nil {
+			return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	if err = q.UpdateConversationAvatar(ctx, db.UpdateConversationAvatarParams{AvatarPath: avatarPath, ID: chatId}); err != nil {
+		s.removeAvatar(ctx, avatarPath)
+		return nil, rollbackOnError(tx, err)
+	}
+	message, err := createSystemMessage(ctx, q, chatId, models.SystemGroupAvatar, models.GroupChange{ActorID: userId})
+	if err != nil {
+		s.removeAvatar(ctx, avatarPath)
+		return nil, rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		s.removeAvatar(ctx, avatarPath)
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.removeAvatar(ctx, chat.AvatarPath)
+	chat.AvatarPath = avatarPath
+	result := models.NewChat(chat)
+	s.Hub.Publish(realtime.Event{Type: realtime.ConversationUpdated, ConversationID: chatId, Payload: result})
+	s.publishMessage(message)
+	return &result, nil
+}
+
+// removeAvatar deletes stored avatar file, failures are only logged
+func (s *ConversationService) removeAvatar(ctx context.Context, avatarPath sql.NullString) {
+	if !avatarPath.Valid {
+		return
+	}
+	if err := s.Files.Delete(ctx, avatarPath.String); err != nil {
+		log.Printf("remove avatar %s: %v", avatarPath.String, err)
+	}
+}
+
+// OpenAvatar opens chat avatar for its participant, caller closes the Body
+func (s *ConversationService) OpenAvatar(ctx context.Context, chatId, userId int64) (*AttachmentFile, *types.StatusError) {
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	chat, err := s.Queries.GetConversationById(ctx, chatId)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if !chat.AvatarPath.Valid {
+		return nil, &types.StatusError{Err: errors.New("chat has no avatar"), Status: http.StatusNotFound}
+	}
+	ext := path.Ext(chat.AvatarPath.String)
+	result := AttachmentFile{FileName: "avatar" + ext, ContentType: mime.TypeByExtension(ext), Disposition: "inline"}
+	if statErr := openFile(ctx, s.Files, chat.AvatarPath.String, &result); statErr != nil {
+		return nil, statErr
+	}
+	return &result, nil
+}
+
+// MutedForever is stored as muted_until of chats muted without a duration
+var MutedForever = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// Mute silences the chat for the user, zero duration mutes it forever
+func (s *ConversationService) Mute(ctx context.Context, chatId, userId int64, duration time.Duration) *types.StatusError {
+	until := MutedForever
+	if duration > 0 {
+		until = time.Now().UTC().Add(duration)
+	}
+	rows, err := s.Queries.SetChatMutedUntil(ctx, db.SetChatMutedUntilParams{MutedUntil: sql.NullTime{Time: until, Valid: true},
+		UserID: userId, ConversationID: chatId})
+	return participantUpdated(rows, err)
+}
+func (s *ConversationService) Unmute(ctx context.Context, chatId, userId int64) *types.StatusError {
+	rows, err := s.Queries.SetChatMutedUntil(ctx, db.SetChatMutedUntilParams{UserID: userId, ConversationID: chatId})
+	return participantUpdated(rows, err)
+}
+func (s *ConversationService) SetArchived(ctx context.Context, chatId, userId int64, archived bool) *types.StatusError {
+	var value int64
+	if archived {
+		value = 1
+	}
+	rows, err := s.Queries.SetChatArchived(ctx, db.SetChatArchivedParams{Archived: value, UserID: userId, ConversationID: chatId})
+	return participantUpdated(rows, err)
+}
+
+// Pin puts the chat on top of the chat list, zero order appends it after already pinned chats
+func (s *ConversationService) Pin(ctx context.Context, chatId, userId, order int64) *types.StatusError {
+	if order == 0 {
+		last, err := s.Queries.GetMaxPinnedOrder(ctx, userId)
+		if err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		order = last + 1
+	}
+	rows, err := s.Queries.SetChatPinnedOrder(ctx, db.SetChatPinnedOrderParams{PinnedOrder: sql.NullInt64{Int64: order, Valid: true},
+		UserID: userId, ConversationID: chatId})
+	return participantUpdated(rows, err)
+}
+func (s *ConversationService) Unpin(ctx context.Context, chatId, userId int64) *types.StatusError {
+	rows, err := s.Queries.SetChatPinnedOrder(ctx, db.SetChatPinnedOrderParams{UserID: userId, ConversationID: chatId})
+	return participantUpdated(rows, err)
+}
+
+// participantUpdated converts result of per participant update, no rows means user isn't in the chat
+func participantUpdated(rows int64, err error) *types.StatusError {
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if rows == 0 {
+		return &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	return nil
+}
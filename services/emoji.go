@@ -0,0 +1,77 @@
+package services
+
+// pictographic approximates Unicode Extended_Pictographic property, which the unicode package doesn't have
+var pictographic = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049}, {0x2122, 0x2122}, {0x2139, 0x2139},
+	{0x2194, 0x2199}, {0x21A9, 0x21AA}, {0x231A, 0x231B}, {0x2328, 0x2328}, {0x23CF, 0x23CF}, {0x23E9, 0x23F3},
+	{0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB}, {0x25B6, 0x25B6}, {0x25C0, 0x25C0}, {0x25FB, 0x25FE},
+	{0x2600, 0x27BF}, {0x2934, 0x2935}, {0x2B05, 0x2B07}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55},
+	{0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297}, {0x3299, 0x3299},
+	{0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA}, {0x1F400, 0x1FAFF},
+}
+
+const (
+	zeroWidthJoiner   = 0x200D
+	emojiPresentation = 0xFE0F
+	textPresentation  = 0xFE0E
+	combiningKeycap   = 0x20E3
+	blackFlag         = 0x1F3F4
+	cancelTag         = 0xE007F
+)
+
+func isPictographic(r rune) bool {
+	for _, bounds := range pictographic {
+		if r >= bounds[0] && r <= bounds[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func isSkinTone(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
+
+// isEmoji reports whether s is exactly one emoji: a pictographic character with optional presentation
+// selector and skin tone, a zero width joiner sequence of them, a keycap, a country flag or a subdivision flag
+func isEmoji(s string) bool {
+	runes := []rune(s)
+	switch {
+	case len(runes) == 0:
+		return false
+	case runes[len(runes)-1] == combiningKeycap:
+		base := runes[:len(runes)-1]
+		if len(base) == 2 && base[1] == emojiPresentation {
+			base = base[:1]
+		}
+		return len(base) == 1 && (base[0] >= '0' && base[0] <= '9' || base[0] == '#' || base[0] == '*')
+	case isRegionalIndicator(runes[0]):
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	case runes[0] == blackFlag && len(runes) > 2 && runes[len(runes)-1] == cancelTag:
+		for _, r := range runes[1 : len(runes)-1] {
+			if r < 0xE0020 || r > 0xE007E {
+				return false
+			}
+		}
+		return true
+	}
+	expectBase := true
+	for _, r := range runes {
+		switch {
+		case expectBase:
+			if !isPictographic(r) {
+				return false
+			}
+			expectBase = false
+		case r == zeroWidthJoiner:
+			expectBase = true
+		case r != emojiPresentation && r != textPresentation && !isSkinTone(r):
+			return false
+		}
+	}
+	return !expectBase
+}
@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestIsEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji string
+		want  bool
+	}{
+		{name: "simple", emoji: "😀", want: true},
+		{name: "presentation selector", emoji: "❤️", want: true},
+		{name: "skin tone", emoji: "👍🏽", want: true},
+		{name: "zero width joiner sequence", emoji: "👩‍💻", want: true},
+		{name: "family", emoji: "👨‍👩‍👧‍👦", want: true},
+		{name: "keycap", emoji: "1️⃣", want: true},
+		{name: "country flag", emoji: "🇺🇦", want: true},
+		{name: "subdivision flag", emoji: "🏴󠁧󠁢󠁳󠁣󠁴󠁿", want: true},
+		{name: "empty", emoji: "", want: false},
+		{name: "text", emoji: "lol", want: false},
+		{name: "digit", emoji: "1", want: false},
+		{name: "two emoji", emoji: "😀😀", want: false},
+		{name: "emoji with text", emoji: "😀a", want: false},
+		{name: "dangling joiner", emoji: "👩‍", want: false},
+		{name: "single regional indicator", emoji: "🇺", want: false},
+		{name: "skin tone alone", emoji: "🏽", want: false},
+		{name: "markup", emoji: "<b>", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEmoji(tt.emoji); got != tt.want {
+				t.Errorf("isEmoji(%q) = %v, want %v", tt.emoji, got, tt.want)
+			}
+		})
+	}
+}
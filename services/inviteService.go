@@ -0,0 +1,143 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/realtime"
+	"awesomeProject/types"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type InviteService struct {
+	Queries       *db.Queries
+	Database      *sql.DB
+	Conversations *ConversationService
+}
+
+func NewInviteService(queries *db.Queries, database *sql.DB, conversations *ConversationService) *InviteService {
+	return &InviteService{queries, database, conversations}
+}
+
+func (s *InviteService) CreateInvite(ctx context.Context, chatId, userId int64, request models.CreateInviteRequest) (*db.Invite, *types.StatusError) {
+	if _, statErr := s.Conversations.requireGroupPermission(ctx, chatId, userId, PermissionManageMembers); statErr != nil {
+		return nil, statErr
+	}
+	code, err := randomCode()
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	params := db.CreateInviteParams{Code: code, ConversationID: chatId, CreatedBy: sql.NullInt64{Int64: userId, Valid: true}}
+	if request.ExpiresInSeconds > 0 {
+		params.ExpiresAt = sql.NullTime{Time: time.Now().UTC().Add(time.Duration(request.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+	if request.MaxUses > 0 {
+		params.MaxUses = sql.NullInt64{Int64: request.MaxUses, Valid: true}
+	}
+	invite, err := s.Queries.CreateInvite(ctx, params)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return &invite, nil
+}
+
+func (s *InviteService) GetInvites(ctx context.Context, chatId, userId int64) ([]db.Invite, *types.StatusError) {
+	if _, statErr := s.Conversations.requireGroupPermission(ctx, chatId, userId, PermissionManageMembers); statErr != nil {
+		return nil, statErr
+	}
+	invites, err := s.Queries.GetChatInvites(ctx, chatId)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return invites, nil
+}
+
+func (s *InviteService) RevokeInvite(ctx context.Context, code string, userId int64) *types.StatusError {
+	invite, statErr := s.getInvite(ctx, code)
+	if statErr != nil {
+		return statErr
+	}
+	if _, statErr = s.Conversations.requireGroupPermission(ctx, invite.ConversationID, userId, PermissionManageMembers); statErr != nil {
+		return statErr
+	}
+	if err := s.Queries.RevokeInvite(ctx, invite.ID); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// AcceptInvite adds user to the group of the invite and returns the group id
+func (s *InviteService) AcceptInvite(ctx context.Context, code string, userId int64) (int64, *types.StatusError) {
+	invite, statErr := s.getInvite(ctx, code)
+	if statErr != nil {
+		return 0, statErr
+	}
+	if invite.Revoked == 1 || (invite.ExpiresAt.Valid && invite.ExpiresAt.Time.Before(time.Now())) {
+		return 0, &types.StatusError{Err: errors.New("invite expired"), Status: http.StatusGone}
+	}
+	chatId := invite.ConversationID
+	if statErr = s.Conversations.requireGroup(ctx, chatId); statErr != nil {
+		return 0, statErr
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return 0, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res != 0 {
+		return chatId, nil
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	used, err := q.UseInvite(ctx, invite.ID)
+	if err != nil {
+		return 0, rollbackOnError(tx, err)
+	}
+	if used == 0 {
+		tx.Rollback()
+		return 0, &types.StatusError{Err: errors.New("invite usage limit reached"), Status: http.StatusGone}
+	}
+	err = q.AddParticipantsToChat(ctx, db.AddParticipantsToChatParams{UserID: userId, ConversationID: chatId, Role: RoleMember})
+	if err != nil {
+		return 0, rollbackOnError(tx, err)
+	}
+	change := models.MemberChange{UserID: userId, ActorID: userId}
+	message, err := createSystemMessage(ctx, q, chatId, models.SystemMemberJoined, change)
+	if err != nil {
+		return 0, rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Conversations.Hub.Join(userId, chatId)
+	s.Conversations.Hub.Publish(realtime.Event{Type: realtime.MemberAdded, ConversationID: chatId, Payload: change})
+	s.Conversations.publishMessage(message)
+	return chatId, nil
+}
+
+func (s *InviteService) getInvite(ctx context.Context, code string) (*db.Invite, *types.StatusError) {
+	invite, err := s.Queries.GetInviteByCode(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("invite not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return &invite, nil
+}
+
+// randomCode returns url safe random string used for invite codes and file names
+func randomCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -2,24 +2,41 @@ package services
 
 import (
 	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/realtime"
+	"awesomeProject/storage"
 	"awesomeProject/types"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/gabriel-vasile/mimetype"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 type MessageService struct {
 	Queries  *db.Queries
 	Database *sql.DB
+	Hub      *realtime.Hub
+	// Files keeps message attachments
+	Files      storage.Storage
+	Thumbnails *ThumbnailService
+	// EditWindow limits UpdateMessage to recently sent messages, zero (the default) allows editing forever
+	EditWindow time.Duration
 }
 
-func NewMessageService(queries *db.Queries, database *sql.DB) *MessageService {
-	return &MessageService{queries, database}
+func NewMessageService(queries *db.Queries, database *sql.DB, hub *realtime.Hub, files storage.Storage, thumbnails *ThumbnailService) *MessageService {
+	return &MessageService{Queries: queries, Database: database, Hub: hub, Files: files, Thumbnails: thumbnails}
 }
-func (s *MessageService) GetChatMessages(ctx context.Context, chatId, userId int64, pageSize, page int64) ([]db.Message, *types.StatusError) {
+func (s *MessageService) GetChatMessages(ctx context.Context, chatId, userId int64, pageSize, page int64) ([]models.ChatMessage, *types.StatusError) {
 	res, err := s.Queries.
 		CheckUserInChat(ctx,
 			db.CheckUserInChatParams{ConversationID: chatId, UserID: userId})
@@ -30,39 +47,107 @@ func (s *MessageService) GetChatMessages(ctx context.Context, chatId, userId int
 		return nil, &types.StatusError{Err: errors.
 			New("forbidden action, trying get access to other people dialog"), Status: http.StatusForbidden}
 	}
-	messages, err := s.Queries.GetMessageThread(ctx, db.GetMessageThreadParams{ConversationID: chatId, Limit: pageSize,
+	messages, err := s.Queries.GetMessageThread(ctx, db.GetMessageThreadParams{ConversationID: chatId, UserID: userId, Limit: pageSize,
 		Offset: (page - 1) * pageSize})
 	if err != nil {
 		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
-	return messages, nil
-}
-func (s *MessageService) SendMessage(ctx context.Context, userId, chatId int64, content string) (*db.Message, *types.StatusError) {
-	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: chatId})
+	result, err := s.toChatMessages(ctx, userId, messages)
 	if err != nil {
-		log.Print(err)
 		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
-	if res == 0 {
-		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	return result, nil
+}
 
+// SendMessage writes message to the chat, non zero replyToId makes it a reply to a message of the same chat.
+// uploadIds attach files of finished resumable uploads to the message
+func (s *MessageService) SendMessage(ctx context.Context, userId, chatId int64, content string, replyToId int64, uploadIds []string) (*models.ChatMessage, *types.StatusError) {
+	if len(uploadIds) > MaxAttachments {
+		return nil, &types.StatusError{Err: fmt.Errorf("message can't have more than %d attachments", MaxAttachments), Status: http.StatusBadRequest}
 	}
-	message, err := s.Queries.CreateMessage(ctx,
-		db.CreateMessageParams{ConversationID: chatId, SenderID: sql.NullInt64{Int64: userId, Valid: true}, Content: content})
-	if err != nil {
+	chat, statErr := s.checkCanPost(ctx, chatId, userId)
+	if statErr != nil {
+		return nil, statErr
+	}
+	params := db.CreateMessageParams{ConversationID: chatId, SenderID: sql.NullInt64{Int64: userId, Valid: true}, Content: content}
+	if replyToId != 0 {
+		if _, statErr = s.replyTarget(ctx, chatId, replyToId); statErr != nil {
+			return nil, statErr
+		}
+		params.ReplyToID = sql.NullInt64{Int64: replyToId, Valid: true}
+	}
+	attachments, statErr := s.uploadedAttachments(ctx, userId, chatId, uploadIds)
+	if statErr != nil {
+		return nil, statErr
+	}
+	message, statErr := s.createMessage(ctx, params, attachments, uploadIds)
+	if statErr != nil {
+		return nil, statErr
+	}
+	if len(attachments) > 0 {
+		s.Thumbnails.Enqueue()
+	}
+	if err := s.unhide(ctx, chat.ID); err != nil {
 		log.Println(err)
+	}
+	result, err := s.toChatMessages(ctx, userId, []db.Message{message})
+	if err != nil {
 		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
-	return &message, nil
+	s.Hub.Publish(realtime.Event{Type: realtime.MessageCreated, ConversationID: chatId, Payload: result[0]})
+	return &result[0], nil
+}
 
+// createMessage saves message with its attachments in one transaction, uploadIds are upload sessions
+// the attachments were taken from, they are removed so one upload can't be attached twice
+func (s *MessageService) createMessage(ctx context.Context, params db.CreateMessageParams, attachments []db.CreateAttachmentParams, uploadIds []string) (db.Message, *types.StatusError) {
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return db.Message{}, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	message, err := q.CreateMessage(ctx, params)
+	if err != nil {
+		return db.Message{}, rollbackOnError(tx, err)
+	}
+	for _, attachment := range attachments {
+		attachment.MessageID = message.ID
+		if _, err = q.CreateAttachment(ctx, attachment); err != nil {
+			return db.Message{}, rollbackOnError(tx, err)
+		}
+	}
+	for _, id := range uploadIds {
+		rows, err := q.DeleteUploadSession(ctx, id)
+		if err != nil {
+			return db.Message{}, rollbackOnError(tx, err)
+		}
+		if rows == 0 {
+			tx.Rollback()
+			return db.Message{}, &types.StatusError{Err: fmt.Errorf("upload %s not found", id), Status: http.StatusNotFound}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return db.Message{}, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return message, nil
 }
-func (s *MessageService) GetLatestChats(ctx context.Context, userId int64) (*[]db.Message, *types.StatusError) {
-	messages, err := s.Queries.GetLatestChats(ctx, userId)
+
+// GetLatestChats lists chats with the last message, pinned ones first. Archived chats are listed only when asked
+func (s *MessageService) GetLatestChats(ctx context.Context, userId int64, includeArchived bool) ([]models.ChatListItem, *types.StatusError) {
+	params := db.GetLatestChatsParams{UserID: userId}
+	if includeArchived {
+		params.Archived = 1
+	}
+	rows, err := s.Queries.GetLatestChats(ctx, params)
 	if err != nil {
 		log.Println(err)
 		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
-	return &messages, nil
+	chats := make([]models.ChatListItem, 0, len(rows))
+	for _, row := range rows {
+		chats = append(chats, models.NewChatListItem(row))
+	}
+	return chats, nil
 }
 func (s *MessageService) SendMessageToUser(ctx context.Context, userId, receiverId int64, content string) (int64, *types.StatusError) {
 	res, err := s.Queries.CheckUserExist(ctx, receiverId)
@@ -85,21 +170,21 @@ func (s *MessageService) SendMessageToUser(ctx context.Context, userId, receiver
 		return 0, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
 	q := db.New(tx)
-	cv, err := q.CreateConversation(ctx, db.CreateConversationParams{IsGroup: sql.NullInt64{0, true}})
+	cv, err := q.CreateConversation(ctx, db.CreateConversationParams{IsGroup: sql.NullInt64{Int64: 0, Valid: true}})
 	if err != nil {
 		fmt.Println(err)
 		return 0, rollbackOnError(tx, err)
 	}
 	for _, v := range []int64{userId, receiverId} {
-		err = q.AddParticipantsToChat(ctx, db.AddParticipantsToChatParams{UserID: v, ConversationID: cv.ID})
+		err = q.AddParticipantsToChat(ctx, db.AddParticipantsToChatParams{UserID: v, ConversationID: cv.ID, Role: RoleMember})
 		if err != nil {
 			fmt.Println(err)
 			return 0, rollbackOnError(tx, err)
 		}
 	}
-	_, err = q.
+	message, err := q.
 		CreateMessage(ctx, db.CreateMessageParams{ConversationID: cv.ID,
-			SenderID: sql.NullInt64{userId, true}, Content: content})
+			SenderID: sql.NullInt64{Int64: userId, Valid: true}, Content: content})
 	if err != nil {
 		fmt.Println(err)
 		return 0, rollbackOnError(tx, err)
@@ -108,21 +193,66 @@ func (s *MessageService) SendMessageToUser(ctx context.Context, userId, receiver
 	if err != nil {
 		return 0, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
+	s.Hub.Join(userId, cv.ID)
+	s.Hub.Join(receiverId, cv.ID)
+	s.publishMessage(ctx, realtime.MessageCreated, userId, message)
 	return cv.ID, nil
 }
+
+// DeleteMessage erases the message for everyone leaving a tombstone. Sender can delete own messages,
+// group admins can delete any message of the group
 func (s *MessageService) DeleteMessage(ctx context.Context, messageId, userId int64) *types.StatusError {
 	mess, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
 	if err != nil {
 		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
-	if !mess.SenderID.Valid || mess.SenderID.Int64 != userId {
-		return &types.StatusError{Err: errors.New("only sender can remove a message"),
-			Status: http.StatusForbidden}
+	permission := PermissionDeleteMessages
+	if mess.SenderID.Valid && mess.SenderID.Int64 == userId {
+		permission = PermissionRead
+	}
+	if _, statErr := checkPermission(ctx, s.Queries, mess.ConversationID, userId, permission); statErr != nil {
+		return statErr
+	}
+	if mess.DeletedAt.Valid {
+		return nil
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	if err = q.SoftDeleteMessage(ctx, messageId); err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = q.DeleteMessageRevisions(ctx, messageId); err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = q.DeleteMessageReactions(ctx, messageId); err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if _, err = q.UnpinMessage(ctx, messageId); err != nil {
+		return rollbackOnError(tx, err)
 	}
-	err = s.Queries.DeleteMessage(ctx, messageId)
+	deleted, err := q.DeleteMessageAttachments(ctx, messageId)
 	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	keys := make([]string, 0, len(deleted))
+	for _, d := range deleted {
+		keys = append(keys, d.StorageKey)
+		if d.ThumbnailKey.Valid {
+			keys = append(keys, d.ThumbnailKey.String)
+		}
+	}
+	if err = tx.Commit(); err != nil {
 		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
+	s.deleteFiles(ctx, keys)
+	s.Hub.Publish(realtime.Event{Type: realtime.MessageDeleted, ConversationID: mess.ConversationID,
+		Payload: realtime.MessageDeletedPayload{MessageID: messageId}})
 	return nil
 }
 func rollbackOnError(tsx *sql.Tx, err error) *types.StatusError {
@@ -133,6 +263,9 @@ func rollbackOnError(tsx *sql.Tx, err error) *types.StatusError {
 }
 func (s *MessageService) UpdateMessage(ctx context.Context, userId, messageId int64, content string) *types.StatusError {
 	message, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
 	if err != nil {
 		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
@@ -140,9 +273,710 @@ func (s *MessageService) UpdateMessage(ctx context.Context, userId, messageId in
 		return &types.StatusError{Err: errors.New("only sender can change the message"),
 			Status: http.StatusForbidden}
 	}
-	err = s.Queries.UpdateMessageText(ctx, db.UpdateMessageTextParams{ID: messageId, Content: content})
+	if message.DeletedAt.Valid {
+		return &types.StatusError{Err: errors.New("message is deleted"), Status: http.StatusConflict}
+	}
+	if s.EditWindow > 0 && time.Since(message.SentAt) > s.EditWindow {
+		return &types.StatusError{Err: errors.New("message can't be edited anymore"), Status: http.StatusForbidden}
+	}
+	if _, statErr := s.checkCanPost(ctx, message.ConversationID, userId); statErr != nil {
+		return statErr
+	}
+	updated, err := s.Queries.UpdateMessageText(ctx, db.UpdateMessageTextParams{ID: messageId, Content: content})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.publishMessage(ctx, realtime.MessageUpdated, userId, updated)
+	return nil
+}
+
+// MarkRead moves user's read marker up to messageId, zero means the latest message of the chat.
+// Marker never moves backwards.
+func (s *MessageService) MarkRead(ctx context.Context, userId, chatId, messageId int64) *types.StatusError {
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	if messageId == 0 {
+		messageId, err = s.Queries.GetLastMessageId(ctx, chatId)
+		if err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if messageId == 0 {
+			return nil
+		}
+	} else {
+		message, err := s.Queries.GetMessageById(ctx, messageId)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && message.ConversationID != chatId) {
+			return &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+		}
+		if err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+	}
+	err = s.Queries.UpdateLastReadMessage(ctx, db.UpdateLastReadMessageParams{MessageID: messageId,
+		UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.MessageRead, ConversationID: chatId,
+		Payload: models.ReadReceipt{UserID: userId, MessageID: messageId}})
+	return nil
+}
+
+// GetMessageReaders returns participants who have read the message, sender excluded
+func (s *MessageService) GetMessageReaders(ctx context.Context, userId, messageId int64) ([]models.MessageReader, *types.StatusError) {
+	message, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: message.ConversationID})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	rows, err := s.Queries.GetMessageReaders(ctx, db.GetMessageReadersParams{ConversationID: message.ConversationID,
+		MessageID: messageId, SenderID: message.SenderID.Int64})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	readers := make([]models.MessageReader, 0, len(rows))
+	for _, row := range rows {
+		readers = append(readers, models.MessageReader{UserID: row.ID, Username: row.Username.String})
+	}
+	return readers, nil
+}
+
+// checkCanPost checks that user may write to the chat, channels accept messages only from admins
+func (s *MessageService) checkCanPost(ctx context.Context, chatId, userId int64) (*db.Conversation, *types.StatusError) {
+	chat, err := s.Queries.GetConversationById(ctx, chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("chat not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	permission := PermissionSendMessage
+	if chat.IsChannel == 1 {
+		permission = PermissionBroadcast
+	}
+	if _, statErr := checkPermission(ctx, s.Queries, chatId, userId, permission); statErr != nil {
+		return nil, statErr
+	}
+	return &chat, nil
+}
+
+// replyTarget loads the message a new message replies to, it has to be a live message of the same chat
+func (s *MessageService) replyTarget(ctx context.Context, chatId, replyToId int64) (*db.Message, *types.StatusError) {
+	parent, err := s.Queries.GetMessageById(ctx, replyToId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (parent.ConversationID != chatId || parent.DeletedAt.Valid)) {
+		return nil, &types.StatusError{Err: errors.New("replied message not found in chat"), Status: http.StatusBadRequest}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return &parent, nil
+}
+
+// unhide brings the chat back to the list of every participant who hid it, a new message is news for all of them
+func (s *MessageService) unhide(ctx context.Context, chatId int64) error {
+	return s.Queries.UnhideConversation(ctx, chatId)
+}
+
+// GetThread returns the message with every reply to it and replies to those replies
+func (s *MessageService) GetThread(ctx context.Context, messageId, userId int64) (*models.MessageThread, *types.StatusError) {
+	root, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{ConversationID: root.ConversationID, UserID: userId})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.
+			New("forbidden action, trying get access to other people dialog"), Status: http.StatusForbidden}
+	}
+	replies, err := s.Queries.GetReplyThread(ctx, db.GetReplyThreadParams{RootID: sql.NullInt64{Int64: messageId, Valid: true}, UserID: userId})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	messages, err := s.toChatMessages(ctx, userId, append([]db.Message{root}, replies...))
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return &models.MessageThread{Root: messages[0], ReplyCount: len(replies), Replies: messages[1:]}, nil
+}
+
+// publishMessage sends the message to the chat in the same shape as chat history
+func (s *MessageService) publishMessage(ctx context.Context, eventType string, userId int64, message db.Message) {
+	result, err := s.toChatMessages(ctx, userId, []db.Message{message})
+	if err != nil {
+		log.Printf("publish message %d: %v", message.ID, err)
+		return
+	}
+	s.Hub.Publish(realtime.Event{Type: eventType, ConversationID: message.ConversationID, Payload: result[0]})
+}
+
+// toChatMessages attaches preview of the replied message and reactions summary seen by userId
+func (s *MessageService) toChatMessages(ctx context.Context, userId int64, messages []db.Message) ([]models.ChatMessage, error) {
+	result := make([]models.ChatMessage, len(messages))
+	ids := make([]int64, 0, len(messages))
+	var parentIds []int64
+	for i, m := range messages {
+		result[i].Message = models.NewMessage(m)
+		ids = append(ids, m.ID)
+		if m.ReplyToID.Valid {
+			parentIds = append(parentIds, m.ReplyToID.Int64)
+		}
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	reactions, err := s.Queries.GetMessagesReactions(ctx, db.GetMessagesReactionsParams{UserID: userId, Ids: ids})
+	if err != nil {
+		return nil, err
+	}
+	summaries := map[int64][]models.ReactionSummary{}
+	for _, r := range reactions {
+		summaries[r.MessageID] = append(summaries[r.MessageID],
+			models.ReactionSummary{Emoji: r.Emoji, Count: r.Count, Reacted: r.Reacted == 1})
+	}
+	attachments, err := s.Queries.GetMessagesAttachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	files := map[int64][]models.Attachment{}
+	for _, a := range attachments {
+		files[a.MessageID] = append(files[a.MessageID], models.NewAttachment(a))
+	}
+	pinnedIds, err := s.Queries.GetPinnedMessageIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	pinned := make(map[int64]bool, len(pinnedIds))
+	for _, id := range pinnedIds {
+		pinned[id] = true
+	}
+	previews := map[int64]*models.MessagePreview{}
+	if len(parentIds) > 0 {
+		parents, err := s.Queries.GetMessagesByIds(ctx, parentIds)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			previews[p.ID] = models.NewMessagePreview(p)
+		}
+	}
+	for i := range result {
+		if result[i].ReplyToID != 0 {
+			result[i].ReplyTo = previews[result[i].ReplyToID]
+		}
+		result[i].Reactions = summaries[result[i].ID]
+		result[i].Pinned = pinned[result[i].ID]
+		result[i].Attachments = files[result[i].ID]
+	}
+	return result, nil
+}
+
+// AddReaction reacts to the message with emoji, reacting twice with the same emoji changes nothing
+func (s *MessageService) AddReaction(ctx context.Context, userId, messageId int64, emoji string) *types.StatusError {
+	return s.changeReaction(ctx, userId, messageId, emoji, true)
+}
+func (s *MessageService) RemoveReaction(ctx context.Context, userId, messageId int64, emoji string) *types.StatusError {
+	return s.changeReaction(ctx, userId, messageId, emoji, false)
+}
+func (s *MessageService) changeReaction(ctx context.Context, userId, messageId int64, emoji string, add bool) *types.StatusError {
+	message, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: message.ConversationID})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	// removal accepts any text so reactions saved before emoji were checked can be taken back
+	if add && !isEmoji(emoji) {
+		return &types.StatusError{Err: errors.New("reaction must be a single emoji"), Status: http.StatusBadRequest}
+	}
+	if add && message.DeletedAt.Valid {
+		return &types.StatusError{Err: errors.New("message is deleted"), Status: http.StatusConflict}
+	}
+	var rows int64
+	eventType := realtime.ReactionAdded
+	if add {
+		rows, err = s.Queries.AddReaction(ctx, db.AddReactionParams{MessageID: messageId, UserID: userId, Emoji: emoji})
+	} else {
+		eventType = realtime.ReactionRemoved
+		rows, err = s.Queries.RemoveReaction(ctx, db.RemoveReactionParams{MessageID: messageId, UserID: userId, Emoji: emoji})
+	}
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if rows > 0 {
+		s.Hub.Publish(realtime.Event{Type: eventType, ConversationID: message.ConversationID,
+			Payload: models.ReactionChange{MessageID: messageId, UserID: userId, Emoji: emoji}})
+	}
+	return nil
+}
+
+// GetMessageHistory lists previous versions of the message, oldest first
+func (s *MessageService) GetMessageHistory(ctx context.Context, userId, messageId int64) ([]models.MessageRevision, *types.StatusError) {
+	message, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: message.ConversationID})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	rows, err := s.Queries.GetMessageRevisions(ctx, messageId)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	revisions := make([]models.MessageRevision, 0, len(rows))
+	for _, r := range rows {
+		revisions = append(revisions, models.NewMessageRevision(r))
+	}
+	return revisions, nil
+}
+
+// HideMessage deletes the message only for the user, others still see it
+func (s *MessageService) HideMessage(ctx context.Context, messageId, userId int64) *types.StatusError {
+	message, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: message.ConversationID})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	if err = s.Queries.HideMessage(ctx, db.HideMessageParams{MessageID: messageId, UserID: userId}); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// ForwardMessages copies messages with their attachments into the chat, copies keep the original sender
+// and conversation. Forwarding a forwarded message keeps its first origin
+func (s *MessageService) ForwardMessages(ctx context.Context, userId, chatId int64, messageIds []int64) ([]models.ChatMessage, *types.StatusError) {
+	chat, statErr := s.checkCanPost(ctx, chatId, userId)
+	if statErr != nil {
+		return nil, statErr
+	}
+	originals, err := s.Queries.GetMessagesByIds(ctx, messageIds)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	found := make(map[int64]bool, len(originals))
+	checked := map[int64]bool{}
+	for _, m := range originals {
+		found[m.ID] = true
+		if !m.SenderID.Valid || m.DeletedAt.Valid {
+			return nil, &types.StatusError{Err: fmt.Errorf("message %d can't be forwarded", m.ID), Status: http.StatusBadRequest}
+		}
+		if checked[m.ConversationID] {
+			continue
+		}
+		res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: m.ConversationID})
+		if err != nil {
+			return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if res == 0 {
+			return nil, &types.StatusError{Err: errors.
+				New("forbidden action, trying get access to other people dialog"), Status: http.StatusForbidden}
+		}
+		checked[m.ConversationID] = true
+	}
+	for _, id := range messageIds {
+		if !found[id] {
+			return nil, &types.StatusError{Err: fmt.Errorf("message %d not found", id), Status: http.StatusNotFound}
+		}
+	}
+	sort.Slice(originals, func(i, j int) bool { return originals[i].ID < originals[j].ID })
+	attachments, keys, statErr := s.copyAttachments(ctx, chatId, messageIds)
+	if statErr != nil {
+		return nil, statErr
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		s.deleteFiles(ctx, keys)
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	copies := make([]db.Message, 0, len(originals))
+	for _, m := range originals {
+		params := db.CreateForwardedMessageParams{ConversationID: chatId, SenderID: sql.NullInt64{Int64: userId, Valid: true},
+			Content: m.Content, ForwardSenderID: m.SenderID, ForwardConversationID: sql.NullInt64{Int64: m.ConversationID, Valid: true}}
+		if m.ForwardSenderID.Valid || m.ForwardConversationID.Valid {
+			params.ForwardSenderID, params.ForwardConversationID = m.ForwardSenderID, m.ForwardConversationID
+		}
+		message, err := q.CreateForwardedMessage(ctx, params)
+		if err != nil {
+			s.deleteFiles(ctx, keys)
+			return nil, rollbackOnError(tx, err)
+		}
+		for _, attachment := range attachments[m.ID] {
+			attachment.MessageID = message.ID
+			if _, err = q.CreateAttachment(ctx, attachment); err != nil {
+				s.deleteFiles(ctx, keys)
+				return nil, rollbackOnError(tx, err)
+			}
+		}
+		copies = append(copies, message)
+	}
+	if err = tx.Commit(); err != nil {
+		s.deleteFiles(ctx, keys)
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if len(keys) > 0 {
+		s.Thumbnails.Enqueue()
+	}
+	if err = s.unhide(ctx, chat.ID); err != nil {
+		log.Println(err)
+	}
+	result, err := s.toChatMessages(ctx, userId, copies)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	for _, m := range result {
+		s.Hub.Publish(realtime.Event{Type: realtime.MessageCreated, ConversationID: chatId, Payload: m})
+	}
+	return result, nil
+}
+
+// copyAttachments stores a copy of every attachment file of the messages under a key of the chat, so
+// deleting either message never removes a file the other one uses. Thumbnails of copies are generated again.
+// Attachments are grouped by original message id, keys of the copies are returned for cleanup on failure
+func (s *MessageService) copyAttachments(ctx context.Context, chatId int64, messageIds []int64) (map[int64][]db.CreateAttachmentParams, []string, *types.StatusError) {
+	originals, err := s.Queries.GetMessagesAttachments(ctx, messageIds)
+	if err != nil {
+		return nil, nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	result := make(map[int64][]db.CreateAttachmentParams, len(originals))
+	keys := make([]string, 0, len(originals))
+	for _, a := range originals {
+		key, err := s.copyFile(ctx, chatId, a.StorageKey)
+		if err != nil {
+			s.deleteFiles(ctx, keys)
+			return nil, nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		keys = append(keys, key)
+		status := a.ThumbnailStatus
+		if status == ThumbnailReady {
+			status = ThumbnailPending
+		}
+		result[a.MessageID] = append(result[a.MessageID], db.CreateAttachmentParams{StorageKey: key, FileName: a.FileName,
+			ContentType: a.ContentType, Size: a.Size, ThumbnailStatus: status})
+	}
+	return result, keys, nil
+}
+
+// copyFile writes content of the stored file under a new attachment key of the chat
+func (s *MessageService) copyFile(ctx context.Context, chatId int64, key string) (string, error) {
+	code, err := randomCode()
+	if err != nil {
+		return "", err
+	}
+	src, err := s.Files.Open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	copyKey := fmt.Sprintf("attachments/%d/%s%s", chatId, code, path.Ext(key))
+	if err = s.Files.Put(ctx, copyKey, src); err != nil {
+		return "", err
+	}
+	return copyKey, nil
+}
+
+// PinMessage pins the message in its chat, in groups only admins can do it
+func (s *MessageService) PinMessage(ctx context.Context, userId, messageId int64) *types.StatusError {
+	return s.changePin(ctx, userId, messageId, true)
+}
+func (s *MessageService) UnpinMessage(ctx context.Context, userId, messageId int64) *types.StatusError {
+	return s.changePin(ctx, userId, messageId, false)
+}
+func (s *MessageService) changePin(ctx context.Context, userId, messageId int64, pin bool) *types.StatusError {
+	message, err := s.Queries.GetMessageById(ctx, messageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &types.StatusError{Err: errors.New("message not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	chat, err := s.Queries.GetConversationById(ctx, message.ConversationID)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	permission := PermissionSendMessage
+	if chat.IsGroup.Int64 == 1 {
+		permission = PermissionPinMessages
+	}
+	if _, statErr := checkPermission(ctx, s.Queries, chat.ID, userId, permission); statErr != nil {
+		return statErr
+	}
+	if pin && (!message.SenderID.Valid || message.DeletedAt.Valid) {
+		return &types.StatusError{Err: errors.New("message can't be pinned"), Status: http.StatusBadRequest}
+	}
+	tx, err := s.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	q := db.New(tx)
+	var rows int64
+	eventType := models.SystemMessagePinned
+	if pin {
+		rows, err = q.PinMessage(ctx, db.PinMessageParams{MessageID: messageId, ConversationID: chat.ID,
+			PinnedBy: sql.NullInt64{Int64: userId, Valid: true}})
+	} else {
+		eventType = models.SystemMessageUnpinned
+		rows, err = q.UnpinMessage(ctx, messageId)
+	}
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if rows == 0 {
+		// already in requested state, nothing to announce
+		if err = tx.Rollback(); err != nil {
+			return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		return nil
+	}
+	system, err := createSystemMessage(ctx, q, chat.ID, eventType, models.PinChange{ActorID: userId, MessageID: messageId})
+	if err != nil {
+		return rollbackOnError(tx, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.publishMessage(ctx, realtime.MessageCreated, userId, system)
+	return nil
+}
+
+// GetPinnedMessages lists pinned messages of the chat, the latest pinned first
+func (s *MessageService) GetPinnedMessages(ctx context.Context, chatId, userId int64) ([]models.ChatMessage, *types.StatusError) {
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{ConversationID: chatId, UserID: userId})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.
+			New("forbidden action, trying get access to other people dialog"), Status: http.StatusForbidden}
+	}
+	messages, err := s.Queries.GetPinnedMessages(ctx, chatId)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	result, err := s.toChatMessages(ctx, userId, messages)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return result, nil
+}
+
+// Attachment limits, MaxAttachmentSize is per file
+const (
+	MaxAttachmentSize = 20 << 20
+	MaxAttachments    = 10
+)
+
+var attachmentTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp",
+	"video/mp4", "video/webm", "audio/mpeg", "audio/ogg", "audio/wav",
+	"application/pdf", "application/zip", "text/plain",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Upload is a file received from client
+type Upload struct {
+	FileName string
+	Size     int64
+	File     io.ReadSeeker
+}
+
+// SendAttachments sends message with files, content is an optional caption
+func (s *MessageService) SendAttachments(ctx context.Context, userId, chatId int64, content string, replyToId int64, uploads []Upload) (*models.ChatMessage, *types.StatusError) {
+	if len(uploads) == 0 || len(uploads) > MaxAttachments {
+		return nil, &types.StatusError{Err: fmt.Errorf("message must have from 1 to %d attachments", MaxAttachments), Status: http.StatusBadRequest}
+	}
+	chat, statErr := s.checkCanPost(ctx, chatId, userId)
+	if statErr != nil {
+		return nil, statErr
+	}
+	params := db.CreateMessageParams{ConversationID: chatId, SenderID: sql.NullInt64{Int64: userId, Valid: true}, Content: content}
+	if replyToId != 0 {
+		if _, statErr = s.replyTarget(ctx, chatId, replyToId); statErr != nil {
+			return nil, statErr
+		}
+		params.ReplyToID = sql.NullInt64{Int64: replyToId, Valid: true}
+	}
+	stored := make([]db.CreateAttachmentParams, 0, len(uploads))
+	keys := make([]string, 0, len(uploads))
+	for _, upload := range uploads {
+		if upload.Size == 0 {
+			s.deleteFiles(ctx, keys)
+			return nil, &types.StatusError{Err: fmt.Errorf("%s is empty", upload.FileName), Status: http.StatusBadRequest}
+		}
+		if upload.Size > MaxAttachmentSize {
+			s.deleteFiles(ctx, keys)
+			return nil, &types.StatusError{Err: fmt.Errorf("%s is bigger than 20MB", upload.FileName),
+				Status: http.StatusRequestEntityTooLarge}
+		}
+		attachment, statErr := s.storeUpload(ctx, chatId, upload)
+		if statErr != nil {
+			s.deleteFiles(ctx, keys)
+			return nil, statErr
+		}
+		stored = append(stored, *attachment)
+		keys = append(keys, attachment.StorageKey)
+	}
+	message, statErr := s.createMessage(ctx, params, stored, nil)
+	if statErr != nil {
+		s.deleteFiles(ctx, keys)
+		return nil, statErr
+	}
+	s.Thumbnails.Enqueue()
+	if err := s.unhide(ctx, chat.ID); err != nil {
+		log.Println(err)
+	}
+	result, err := s.toChatMessages(ctx, userId, []db.Message{message})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	s.Hub.Publish(realtime.Event{Type: realtime.MessageCreated, ConversationID: chatId, Payload: result[0]})
+	return &result[0], nil
+}
+
+// storeUpload checks detected content type of the upload and writes it to storage, size is checked by callers
+func (s *MessageService) storeUpload(ctx context.Context, chatId int64, upload Upload) (*db.CreateAttachmentParams, *types.StatusError) {
+	fileType, err := mimetype.DetectReader(upload.File)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusBadRequest}
+	}
+	if !mimetype.EqualsAny(fileType.String(), attachmentTypes...) {
+		return nil, &types.StatusError{Err: fmt.Errorf("unsupported attachment type %s", fileType.String()), Status: http.StatusUnsupportedMediaType}
+	}
+	if _, err = upload.File.Seek(0, io.SeekStart); err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	code, err := randomCode()
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	key := fmt.Sprintf("attachments/%d/%s%s", chatId, code, fileType.Extension())
+	if err = s.Files.Put(ctx, key, upload.File); err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	name := filepath.Base(upload.FileName)
+	if name == "." || name == string(filepath.Separator) {
+		name = "file" + fileType.Extension()
+	}
+	thumbnailStatus := ThumbnailNone
+	if thumbnailTypes[fileType.String()] {
+		thumbnailStatus = ThumbnailPending
+	}
+	return &db.CreateAttachmentParams{StorageKey: key, FileName: name, ContentType: fileType.String(), Size: upload.Size,
+		ThumbnailStatus: thumbnailStatus}, nil
+}
+
+// AttachmentFile is an opened stored file, Size is zero when unknown. Storages able to presign links
+// give URL to download the file from instead of Body. Disposition is "attachment" or "inline"
+type AttachmentFile struct {
+	FileName    string
+	ContentType string
+	Disposition string
+	Size        int64
+	Body        io.ReadCloser
+	URL         string
+}
+
+// OpenAttachment opens attachment file or its thumbnail for a participant of the chat, caller closes the Body
+func (s *MessageService) OpenAttachment(ctx context.Context, userId, attachmentId int64, thumbnail bool) (*AttachmentFile, *types.StatusError) {
+	attachment, err := s.Queries.GetAttachment(ctx, attachmentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("attachment not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: attachment.ConversationID})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	result := AttachmentFile{FileName: attachment.FileName, ContentType: attachment.ContentType, Disposition: "attachment",
+		Size: attachment.Size}
+	key := attachment.StorageKey
+	if thumbnail {
+		if !attachment.ThumbnailKey.Valid {
+			return nil, &types.StatusError{Err: errors.New("attachment has no thumbnail"), Status: http.StatusNotFound}
+		}
+		key = attachment.ThumbnailKey.String
+		result.ContentType = mime.TypeByExtension(path.Ext(key))
+		result.FileName = strings.TrimSuffix(attachment.FileName, path.Ext(attachment.FileName)) + "_thumb" + path.Ext(key)
+		result.Size = 0
+	}
+	if statErr := openFile(ctx, s.Files, key, &result); statErr != nil {
+		return nil, statErr
+	}
+	return &result, nil
+}
+
+// openFile presigns download link of the key when storage supports it, otherwise file is opened
+func openFile(ctx context.Context, files storage.Storage, key string, file *AttachmentFile) *types.StatusError {
+	var err error
+	if presigner, ok := files.(storage.Presigner); ok {
+		file.URL, err = presigner.PresignGet(ctx, key, file.Disposition, file.FileName, file.ContentType)
+	} else {
+		file.Body, err = files.Open(ctx, key)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return &types.StatusError{Err: errors.New("file not found"), Status: http.StatusNotFound}
+	}
 	if err != nil {
 		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
 	}
 	return nil
 }
+
+// deleteFiles removes stored files, failures are only logged because rows are already gone
+func (s *MessageService) deleteFiles(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.Files.Delete(ctx, key); err != nil {
+			log.Printf("delete file %s: %v", key, err)
+		}
+	}
+}
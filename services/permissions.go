@@ -0,0 +1,76 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/types"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// Participant roles, ordered from the most powerful one
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "readonly"
+)
+
+var roleRanks = map[string]int{RoleReadOnly: 0, RoleMember: 1, RoleAdmin: 2, RoleOwner: 3}
+
+type Permission int
+
+const (
+	PermissionRead Permission = iota
+	PermissionSendMessage
+	PermissionBroadcast
+	PermissionManageMembers
+	PermissionDeleteMessages
+	PermissionPinMessages
+	PermissionManageChat
+	PermissionManageAdmins
+	PermissionDeleteChat
+)
+
+// permissionRoles is the lowest role which has the permission
+var permissionRoles = map[Permission]string{
+	PermissionRead:           RoleReadOnly,
+	PermissionSendMessage:    RoleMember,
+	PermissionBroadcast:      RoleAdmin,
+	PermissionManageMembers:  RoleAdmin,
+	PermissionDeleteMessages: RoleAdmin,
+	PermissionPinMessages:    RoleAdmin,
+	PermissionManageChat:     RoleAdmin,
+	PermissionManageAdmins:   RoleOwner,
+	PermissionDeleteChat:     RoleOwner,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+func HasPermission(role string, permission Permission) bool {
+	return roleRanks[role] >= roleRanks[permissionRoles[permission]]
+}
+
+// outranks reports whether role is strictly higher than other
+func outranks(role, other string) bool {
+	return roleRanks[role] > roleRanks[other]
+}
+
+// checkPermission loads participant of the chat and checks that the role allows the action
+func checkPermission(ctx context.Context, q *db.Queries, chatId, userId int64, permission Permission) (*db.ConversationParticipant, *types.StatusError) {
+	participant, err := q.GetParticipant(ctx, db.GetParticipantParams{UserID: userId, ConversationID: chatId})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if !HasPermission(participant.Role, permission) {
+		return nil, &types.StatusError{Err: errors.New("not enough rights in chat"), Status: http.StatusForbidden}
+	}
+	return &participant, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestCheckPermission(t *testing.T) {
+	_, queries := openTestDatabase(t)
+	tests := []struct {
+		name       string
+		userId     int64
+		chatId     int64
+		permission Permission
+		wantStatus int
+	}{
+		{name: "owner deletes chat", userId: 1, chatId: 1, permission: PermissionDeleteChat},
+		{name: "admin can't delete chat", userId: 2, chatId: 1, permission: PermissionDeleteChat, wantStatus: http.StatusForbidden},
+		{name: "owner manages admins", userId: 1, chatId: 1, permission: PermissionManageAdmins},
+		{name: "admin can't manage admins", userId: 2, chatId: 1, permission: PermissionManageAdmins, wantStatus: http.StatusForbidden},
+		{name: "admin deletes messages", userId: 2, chatId: 1, permission: PermissionDeleteMessages},
+		{name: "admin manages members", userId: 2, chatId: 1, permission: PermissionManageMembers},
+		{name: "member can't delete messages", userId: 3, chatId: 1, permission: PermissionDeleteMessages, wantStatus: http.StatusForbidden},
+		{name: "member sends messages", userId: 3, chatId: 1, permission: PermissionSendMessage},
+		{name: "member can't broadcast", userId: 3, chatId: 2, permission: PermissionBroadcast, wantStatus: http.StatusForbidden},
+		{name: "reader can't send messages", userId: 4, chatId: 1, permission: PermissionSendMessage, wantStatus: http.StatusForbidden},
+		{name: "reader reads", userId: 4, chatId: 1, permission: PermissionRead},
+		{name: "stranger can't read", userId: 5, chatId: 1, permission: PermissionRead, wantStatus: http.StatusForbidden},
+		{name: "missing chat", userId: 1, chatId: 100, permission: PermissionRead, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			participant, statErr := checkPermission(context.Background(), queries, tt.chatId, tt.userId, tt.permission)
+			if tt.wantStatus != 0 {
+				if statErr == nil || statErr.Status != tt.wantStatus {
+					t.Fatalf("got %v, want status %d", statErr, tt.wantStatus)
+				}
+				return
+			}
+			if statErr != nil {
+				t.Fatalf("unexpected error %v", statErr)
+			}
+			if participant.UserID != tt.userId || participant.ConversationID != tt.chatId {
+				t.Errorf("got participant %d of chat %d", participant.UserID, participant.ConversationID)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/realtime"
+	"awesomeProject/types"
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// OnlineWindow is how long user counts as online after the last authenticated request
+	OnlineWindow = 2 * time.Minute
+	// lastSeenPersistInterval limits how often last_seen_at is written for active users
+	lastSeenPersistInterval = time.Minute
+)
+
+type activity struct {
+	seenAt      time.Time
+	requestAt   time.Time
+	persistedAt time.Time
+}
+
+// PresenceService combines live realtime connections with recent request
+// activity, last_seen_at is kept in database so it survives restarts
+type PresenceService struct {
+	Queries  *db.Queries
+	Hub      *realtime.Hub
+	mu       sync.Mutex
+	activity map[int64]*activity
+}
+
+func NewPresenceService(queries *db.Queries, hub *realtime.Hub) *PresenceService {
+	return &PresenceService{Queries: queries, Hub: hub, activity: map[int64]*activity{}}
+}
+
+// Touch records authenticated request of the user
+func (s *PresenceService) Touch(ctx context.Context, userId int64) {
+	s.record(ctx, userId, true, false)
+}
+
+// Connected must be called after realtime client of the user is registered in the hub
+func (s *PresenceService) Connected(ctx context.Context, userId int64) {
+	s.record(ctx, userId, false, false)
+	if s.Hub.Connections(userId) == 1 {
+		s.notify(ctx, userId)
+	}
+}
+
+// Disconnected must be called after realtime client of the user is unregistered from the hub
+func (s *PresenceService) Disconnected(ctx context.Context, userId int64) {
+	s.record(ctx, userId, false, true)
+	if s.Hub.Connections(userId) == 0 {
+		s.notify(ctx, userId)
+	}
+}
+
+// record updates in memory activity, last_seen_at is written at most once
+// per lastSeenPersistInterval unless force is set
+func (s *PresenceService) record(ctx context.Context, userId int64, request, force bool) {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	a, ok := s.activity[userId]
+	if !ok {
+		a = &activity{}
+		s.activity[userId] = a
+	}
+	a.seenAt = now
+	if request {
+		a.requestAt = now
+	}
+	persist := force || now.Sub(a.persistedAt) >= lastSeenPersistInterval
+	if persist {
+		a.persistedAt = now
+	}
+	s.mu.Unlock()
+	if persist {
+		s.persistLastSeen(ctx, userId, now)
+	}
+}
+
+func (s *PresenceService) SetHideLastSeen(ctx context.Context, userId int64, hide bool) *types.StatusError {
+	var value int64
+	if hide {
+		value = 1
+	}
+	err := s.Queries.UpdateUserHideLastSeen(ctx, db.UpdateUserHideLastSeenParams{HideLastSeen: value, ID: userId})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// GetPresence returns presence of known users, unknown ids are skipped
+func (s *PresenceService) GetPresence(ctx context.Context, userIds []int64) ([]models.Presence, *types.StatusError) {
+	rows, err := s.Queries.GetUsersPresence(ctx, userIds)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	res := make([]models.Presence, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, s.Presence(row.ID, row.LastSeenAt, row.HideLastSeen == 1))
+	}
+	return res, nil
+}
+
+// Presence builds presence of the user from stored last_seen_at and live activity
+func (s *PresenceService) Presence(userId int64, lastSeenAt sql.NullTime, hideLastSeen bool) models.Presence {
+	presence := models.Presence{UserID: userId, Online: s.Hub.Connections(userId) > 0}
+	var seen time.Time
+	if lastSeenAt.Valid {
+		seen = lastSeenAt.Time
+	}
+	s.mu.Lock()
+	if a, ok := s.activity[userId]; ok {
+		if a.seenAt.After(seen) {
+			seen = a.seenAt
+		}
+		presence.Online = presence.Online || time.Since(a.requestAt) < OnlineWindow
+	}
+	s.mu.Unlock()
+	if presence.Online {
+		seen = time.Now().UTC()
+	}
+	if !hideLastSeen && !seen.IsZero() {
+		presence.LastSeenAt = &seen
+	}
+	return presence
+}
+
+func (s *PresenceService) persistLastSeen(ctx context.Context, userId int64, at time.Time) {
+	err := s.Queries.UpdateUserLastSeen(ctx, db.UpdateUserLastSeenParams{LastSeenAt: sql.NullTime{Time: at, Valid: true}, ID: userId})
+	if err != nil {
+		log.Printf("update last seen of user %d: %v", userId, err)
+	}
+}
+
+// notify pushes presence of the user to every conversation of the user
+func (s *PresenceService) notify(ctx context.Context, userId int64) {
+	presence, statErr := s.GetPresence(ctx, []int64{userId})
+	if statErr != nil || len(presence) == 0 {
+		return
+	}
+	chatIds, err := s.Queries.GetUserConversationIds(ctx, userId)
+	if err != nil {
+		log.Printf("presence of user %d: %v", userId, err)
+		return
+	}
+	for _, chatId := range chatIds {
+		s.Hub.Notify(realtime.Event{Type: realtime.PresenceChanged, ConversationID: chatId, Payload: presence[0]}, userId)
+	}
+}
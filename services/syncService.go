@@ -0,0 +1,66 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/types"
+	"context"
+	"net/http"
+)
+
+const (
+	DefaultSyncPageSize = 100
+	MaxSyncPageSize     = 500
+)
+
+type SyncService struct {
+	Queries  *db.Queries
+	Messages *MessageService
+}
+
+func NewSyncService(queries *db.Queries, messages *MessageService) *SyncService {
+	return &SyncService{Queries: queries, Messages: messages}
+}
+
+// GetChanges returns changes visible to the user after since cursor. Changes of
+// conversations the user is in are returned together with the current message state,
+// deleted messages come with deletedAt set, messages hidden by the user are skipped,
+// membership changes of the user are returned even for conversations already left.
+// Messages come with their current reactions, pin and attachments.
+func (s *SyncService) GetChanges(ctx context.Context, userId, since, limit int64) (*models.SyncPage, *types.StatusError) {
+	if limit <= 0 || limit > MaxSyncPageSize {
+		limit = DefaultSyncPageSize
+	}
+	rows, err := s.Queries.GetChangesSince(ctx, db.GetChangesSinceParams{Since: since, UserID: userId, Limit: limit + 1})
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	page := &models.SyncPage{Changes: make([]models.Change, 0, len(rows)), Cursor: since}
+	if int64(len(rows)) > limit {
+		rows = rows[:limit]
+		page.HasMore = true
+	}
+	var messages []db.Message
+	var withMessage []int
+	for i, row := range rows {
+		page.Changes = append(page.Changes, models.Change{ID: row.ID, Kind: row.Kind, ConversationID: row.ConversationID,
+			MessageID: row.MessageID.Int64, UserID: row.UserID.Int64})
+		page.Cursor = row.ID
+		if row.Content.Valid {
+			messages = append(messages, db.Message{ID: row.MessageID.Int64, ConversationID: row.ConversationID,
+				SenderID: row.SenderID, Content: row.Content.String, SentAt: row.SentAt.Time,
+				EventType: row.EventType, EventPayload: row.EventPayload, ReplyToID: row.ReplyToID,
+				EditedAt: row.EditedAt, DeletedAt: row.DeletedAt, ForwardSenderID: row.ForwardSenderID,
+				ForwardConversationID: row.ForwardConversationID})
+			withMessage = append(withMessage, i)
+		}
+	}
+	chatMessages, err := s.Messages.toChatMessages(ctx, userId, messages)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	for i, message := range chatMessages {
+		page.Changes[withMessage[i]].Message = &message
+	}
+	return page, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestGetChanges(t *testing.T) {
+	database, queries := openTestDatabase(t)
+	ctx := context.Background()
+	send := func(chatId, senderId int64, content string) int64 {
+		message, err := queries.CreateMessage(ctx, db.CreateMessageParams{ConversationID: chatId,
+			SenderID: sql.NullInt64{Int64: senderId, Valid: true}, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message.ID
+	}
+	hello := send(1, 1, "hello")
+	hidden := send(1, 1, "hidden by member")
+	deleted := send(1, 3, "deleted")
+	news := send(2, 1, "news")
+	send(3, 5, "private chat of others")
+	if err := queries.HideMessage(ctx, db.HideMessageParams{MessageID: hidden, UserID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := queries.SoftDeleteMessage(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	for _, reaction := range []db.AddReactionParams{
+		{MessageID: hello, UserID: 2, Emoji: "👍"},
+		{MessageID: hello, UserID: 1, Emoji: "🔥"},
+		{MessageID: hidden, UserID: 1, Emoji: "👍"},
+		// reaction in the channel the member leaves, isn't given to them after leaving
+		{MessageID: news, UserID: 3, Emoji: "👍"},
+	} {
+		if _, err := queries.AddReaction(ctx, reaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := queries.RemoveReaction(ctx, db.RemoveReactionParams{MessageID: hello, UserID: 1, Emoji: "🔥"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := queries.UpdateLastReadMessage(ctx, db.UpdateLastReadMessageParams{MessageID: hello, UserID: 2, ConversationID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{hello, deleted} {
+		if _, err := queries.PinMessage(ctx, db.PinMessageParams{MessageID: id, ConversationID: 1,
+			PinnedBy: sql.NullInt64{Int64: 1, Valid: true}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := queries.PinMessage(ctx, db.PinMessageParams{MessageID: news, ConversationID: 2,
+		PinnedBy: sql.NullInt64{Int64: 1, Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queries.UnpinMessage(ctx, news); err != nil {
+		t.Fatal(err)
+	}
+	// the member leaves the channel, the removal is still given to them
+	if _, err := database.Exec("DELETE FROM conversation_participants WHERE user_id = 3 and conversation_id = 2"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := database.Query(`SELECT id FROM changes
+		WHERE (conversation_id = 1 or (user_id = 3 and kind LIKE 'member.%')) and (message_id IS NULL or message_id != ?)
+		ORDER BY id`, hidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, id)
+	}
+	kinds := map[string]int{}
+	kindRows, err := database.Query("SELECT kind, count(*) FROM changes WHERE conversation_id = 1 GROUP BY kind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for kindRows.Next() {
+		var kind string
+		var count int
+		if err = kindRows.Scan(&kind, &count); err != nil {
+			t.Fatal(err)
+		}
+		kinds[kind] = count
+	}
+	if err = kindRows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the pin of the deleted message isn't logged, reactions of the hidden message are filtered out later
+	wantKinds := map[string]int{"message.created": 3, "message.deleted": 1, "reaction.added": 3,
+		"reaction.removed": 1, "message.read": 1, "message.pinned": 1, "member.added": 4}
+	if !maps.Equal(kinds, wantKinds) {
+		t.Errorf("got changes %v of the group, want %v", kinds, wantKinds)
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSyncService(queries, NewMessageService(queries, database, nil, nil, nil))
+	tests := []struct {
+		name  string
+		since int64
+		limit int64
+	}{
+		{name: "one by one", limit: 1},
+		{name: "pages of two", limit: 2},
+		{name: "page of all", limit: int64(len(want))},
+		{name: "default page", limit: 0},
+		{name: "limit over max", limit: MaxSyncPageSize + 1},
+		{name: "from the middle", since: want[len(want)/2], limit: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			cursor := tt.since
+			for pages := 0; ; pages++ {
+				if pages > len(want) {
+					t.Fatal("paging doesn't end")
+				}
+				page, statErr := s.GetChanges(ctx, 3, cursor, tt.limit)
+				if statErr != nil {
+					t.Fatal(statErr)
+				}
+				if tt.limit > 0 && int64(len(page.Changes)) > tt.limit {
+					t.Fatalf("page of %d changes, limit %d", len(page.Changes), tt.limit)
+				}
+				for _, change := range page.Changes {
+					got = append(got, change.ID)
+					if change.MessageID == deleted && (change.Message == nil || change.Message.DeletedAt == nil) {
+						t.Errorf("change %d of deleted message has no deletedAt", change.ID)
+					}
+					if change.MessageID == hello && (change.Message == nil || len(change.Message.Reactions) != 1 || !change.Message.Pinned) {
+						t.Errorf("change %d doesn't have the current reactions and pin: %+v", change.ID, change.Message)
+					}
+				}
+				if len(page.Changes) > 0 && page.Cursor != page.Changes[len(page.Changes)-1].ID {
+					t.Fatalf("cursor %d isn't the last change", page.Cursor)
+				}
+				if !page.HasMore {
+					if page.Cursor < cursor {
+						t.Fatalf("cursor went back from %d to %d", cursor, page.Cursor)
+					}
+					break
+				}
+				cursor = page.Cursor
+			}
+			wantSince := want[slices.IndexFunc(want, func(id int64) bool { return id > tt.since }):]
+			if !slices.Equal(got, wantSince) {
+				t.Errorf("got changes %v, want %v", got, wantSince)
+			}
+		})
+	}
+}
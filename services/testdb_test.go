@@ -0,0 +1,52 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/migrations"
+	"awesomeProject/types"
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testData is a group with a participant of every role, a channel and a private chat the group reader isn't in.
+// User 5 isn't in the group
+const testData = `
+INSERT INTO users (id, username) VALUES (1, 'owner'), (2, 'admin'), (3, 'member'), (4, 'reader'), (5, 'stranger');
+INSERT INTO conversations (id, is_group, name, is_channel) VALUES (1, 1, 'group', 0), (2, 1, 'channel', 1), (3, 0, NULL, 0);
+INSERT INTO conversation_participants (user_id, conversation_id, role)
+VALUES (1, 1, 'owner'), (2, 1, 'admin'), (3, 1, 'member'), (4, 1, 'readonly'),
+       (1, 2, 'owner'), (3, 2, 'member'),
+       (1, 3, 'member'), (5, 3, 'member');`
+
+// openTestDatabase creates a database of schema.sql in a temporary directory filled with testData
+func openTestDatabase(t *testing.T) (*sql.DB, *db.Queries) {
+	t.Helper()
+	database, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "chat.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	ddl, err := os.ReadFile("../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrations.Apply(context.Background(), database, string(ddl)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = database.Exec(testData); err != nil {
+		t.Fatal(err)
+	}
+	return database, db.New(database)
+}
+
+// statusOf is the HTTP status of the error, zero when there is no error
+func statusOf(statErr *types.StatusError) int {
+	if statErr == nil {
+		return 0
+	}
+	return statErr.Status
+}
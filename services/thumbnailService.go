@@ -0,0 +1,234 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/realtime"
+	"awesomeProject/storage"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// Thumbnail statuses of attachments
+const (
+	ThumbnailNone    = "none"
+	ThumbnailPending = "pending"
+	ThumbnailReady   = "ready"
+	ThumbnailFailed  = "failed"
+)
+
+const (
+	// ThumbnailSize is the longest side of generated thumbnails, smaller images get no thumbnail
+	ThumbnailSize = 320
+	// maxImagePixels protects the worker from decompression bombs
+	maxImagePixels = 50_000_000
+	// maxThumbnailSourceSize skips images of resumable uploads too big to be worth decoding
+	maxThumbnailSourceSize = 50 << 20
+	thumbnailBatch         = 20
+	thumbnailScanInterval  = time.Minute
+)
+
+var thumbnailTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+// errBrokenImage marks images which will never get a thumbnail, other errors are retried on the next pass
+var errBrokenImage = errors.New("broken image")
+
+// ThumbnailService generates thumbnails of image attachments in background. Work is taken from
+// attachments with pending status, so nothing is lost when the server restarts
+type ThumbnailService struct {
+	Queries *db.Queries
+	Files   storage.Storage
+	Hub     *realtime.Hub
+	wake    chan struct{}
+}
+
+func NewThumbnailService(queries *db.Queries, files storage.Storage, hub *realtime.Hub) *ThumbnailService {
+	return &ThumbnailService{Queries: queries, Files: files, Hub: hub, wake: make(chan struct{}, 1)}
+}
+
+// Enqueue wakes up the worker after new pending attachments were saved
+func (s *ThumbnailService) Enqueue() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes pending attachments until ctx is done
+func (s *ThumbnailService) Run(ctx context.Context) {
+	ticker := time.NewTicker(thumbnailScanInterval)
+	defer ticker.Stop()
+	for {
+		s.processPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ThumbnailService) processPending(ctx context.Context) {
+	for {
+		pending, err := s.Queries.GetPendingThumbnails(ctx, thumbnailBatch)
+		if err != nil {
+			log.Printf("load pending thumbnails: %v", err)
+			return
+		}
+		for _, attachment := range pending {
+			if err = s.process(ctx, attachment); err != nil {
+				log.Printf("thumbnail of attachment %d: %v", attachment.ID, err)
+				return
+			}
+		}
+		if len(pending) < thumbnailBatch {
+			return
+		}
+	}
+}
+
+// process stores result of thumbnail generation, broken images are marked failed and not retried.
+// On storage errors the attachment stays pending and the error is returned
+func (s *ThumbnailService) process(ctx context.Context, attachment db.Attachment) error {
+	width, height, key, err := s.generate(ctx, attachment)
+	if err != nil && !errors.Is(err, errBrokenImage) {
+		return err
+	}
+	params := db.SetAttachmentThumbnailParams{ID: attachment.ID, ThumbnailStatus: ThumbnailFailed}
+	if err != nil {
+		log.Printf("thumbnail of attachment %d: %v", attachment.ID, err)
+	} else {
+		params.Width = sql.NullInt64{Int64: int64(width), Valid: true}
+		params.Height = sql.NullInt64{Int64: int64(height), Valid: true}
+		params.ThumbnailKey = sql.NullString{String: key, Valid: key != ""}
+		params.ThumbnailStatus = ThumbnailReady
+	}
+	rows, err := s.Queries.SetAttachmentThumbnail(ctx, params)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		// message was deleted meanwhile
+		if key != "" {
+			if err = s.Files.Delete(ctx, key); err != nil {
+				log.Printf("delete thumbnail %s: %v", key, err)
+			}
+		}
+		return nil
+	}
+	message, err := s.Queries.GetMessageById(ctx, attachment.MessageID)
+	if err != nil {
+		return err
+	}
+	attachment.Width, attachment.Height = params.Width, params.Height
+	attachment.ThumbnailKey, attachment.ThumbnailStatus = params.ThumbnailKey, params.ThumbnailStatus
+	s.Hub.Publish(realtime.Event{Type: realtime.AttachmentUpdated, ConversationID: message.ConversationID,
+		Payload: models.NewAttachment(attachment)})
+	return nil
+}
+
+// generate reads image dimensions and writes downscaled copy next to the original,
+// key is empty when the image is already small enough. Dimensions are read from the file header
+// first, so too big images are rejected without decoding them
+func (s *ThumbnailService) generate(ctx context.Context, attachment db.Attachment) (width, height int, key string, err error) {
+	if attachment.Size > maxThumbnailSourceSize {
+		return 0, 0, "", fmt.Errorf("%w: %d bytes is too big", errBrokenImage, attachment.Size)
+	}
+	var config image.Config
+	var format string
+	err = s.readImage(ctx, attachment.StorageKey, func(r io.Reader) (err error) {
+		config, format, err = image.DecodeConfig(r)
+		return err
+	})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return 0, 0, "", fmt.Errorf("%w: %dx%d is too big", errBrokenImage, config.Width, config.Height)
+	}
+	if config.Width <= ThumbnailSize && config.Height <= ThumbnailSize {
+		return config.Width, config.Height, "", nil
+	}
+	var img image.Image
+	err = s.readImage(ctx, attachment.StorageKey, func(r io.Reader) (err error) {
+		img, _, err = image.Decode(r)
+		return err
+	})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	thumbWidth, thumbHeight := ThumbnailSize, ThumbnailSize
+	if config.Width > config.Height {
+		thumbHeight = max(1, config.Height*ThumbnailSize/config.Width)
+	} else {
+		thumbWidth = max(1, config.Width*ThumbnailSize/config.Height)
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, img.Bounds(), draw.Over, nil)
+	var buf bytes.Buffer
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return 0, 0, "", err
+	}
+	key = strings.TrimSuffix(attachment.StorageKey, path.Ext(attachment.StorageKey)) + "_thumb" + ext
+	if err = s.Files.Put(ctx, key, bytes.NewReader(buf.Bytes())); err != nil {
+		return 0, 0, "", err
+	}
+	return config.Width, config.Height, key, nil
+}
+
+// readImage streams stored file to decode, the file is closed after decode returns.
+// Decode errors and missing files are errBrokenImage, failed reads are returned as they are
+func (s *ThumbnailService) readImage(ctx context.Context, key string, decode func(r io.Reader) error) error {
+	file, err := s.Files.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: %w", errBrokenImage, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := &readErrorReader{r: file}
+	if err = decode(bufio.NewReader(r)); err != nil {
+		if r.err != nil {
+			return r.err
+		}
+		return fmt.Errorf("%w: %w", errBrokenImage, err)
+	}
+	return nil
+}
+
+// readErrorReader keeps the read error, so it isn't taken for a broken image by the decoder
+type readErrorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrorReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/realtime"
+	"awesomeProject/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingStorage fails to open files while openErr is set and fails reading them after a few bytes while readErr is set
+type failingStorage struct {
+	storage.Storage
+	openErr error
+	readErr error
+}
+
+func (f *failingStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if f.openErr != nil {
+		return nil, f.openErr
+	}
+	r, err := f.Storage.Open(ctx, key)
+	if err != nil || f.readErr == nil {
+		return r, err
+	}
+	return io.NopCloser(io.MultiReader(io.LimitReader(r, 4), &errorReader{f.readErr})), nil
+}
+
+type errorReader struct{ err error }
+
+func (r *errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestProcessThumbnail(t *testing.T) {
+	unavailable := errors.New("storage is unavailable")
+	tests := []struct {
+		name       string
+		content    string
+		missing    bool
+		openErr    error
+		readErr    error
+		wantStatus string
+		wantErr    bool
+	}{
+		{name: "not an image", content: "plain text", wantStatus: ThumbnailFailed},
+		{name: "missing file", missing: true, wantStatus: ThumbnailFailed},
+		{name: "open fails", content: "plain text", openErr: unavailable, wantStatus: ThumbnailPending, wantErr: true},
+		{name: "read fails", content: "\x89PNG\r\n\x1a\n", readErr: unavailable, wantStatus: ThumbnailPending, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, queries := openTestDatabase(t)
+			ctx := context.Background()
+			local := storage.NewLocal(filepath.Join(t.TempDir(), "uploads"))
+			files := &failingStorage{Storage: local}
+			s := NewThumbnailService(queries, files, realtime.NewHub())
+			message, err := queries.CreateMessage(ctx, db.CreateMessageParams{ConversationID: 1,
+				SenderID: sql.NullInt64{Int64: 1, Valid: true}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := "attachments/1/a.png"
+			if !tt.missing {
+				if err = local.Put(ctx, key, strings.NewReader(tt.content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			attachment, err := queries.CreateAttachment(ctx, db.CreateAttachmentParams{MessageID: message.ID, StorageKey: key,
+				FileName: "a.png", ContentType: "image/png", Size: int64(len(tt.content)), ThumbnailStatus: ThumbnailPending})
+			if err != nil {
+				t.Fatal(err)
+			}
+			files.openErr, files.readErr = tt.openErr, tt.readErr
+			if err = s.process(ctx, attachment); (err != nil) != tt.wantErr {
+				t.Fatalf("process error %v, want error %t", err, tt.wantErr)
+			}
+			got, err := queries.GetAttachment(ctx, attachment.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ThumbnailStatus != tt.wantStatus {
+				t.Errorf("thumbnail status %q, want %q", got.ThumbnailStatus, tt.wantStatus)
+			}
+		})
+	}
+}
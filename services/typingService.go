@@ -0,0 +1,89 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/realtime"
+	"awesomeProject/types"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TypingTimeout is how long typing indicator lives without being refreshed
+const TypingTimeout = 5 * time.Second
+
+type typingKey struct {
+	userId, chatId int64
+}
+
+// typingEntry is a live indicator, expiration of an entry replaced by a refresh is dropped
+type typingEntry struct {
+	timer *time.Timer
+}
+
+// TypingService keeps typing indicators in memory only, they are never stored in database
+type TypingService struct {
+	Queries *db.Queries
+	Hub     *realtime.Hub
+	mu      sync.Mutex
+	timers  map[typingKey]*typingEntry
+}
+
+func NewTypingService(queries *db.Queries, hub *realtime.Hub) *TypingService {
+	return &TypingService{Queries: queries, Hub: hub, timers: map[typingKey]*typingEntry{}}
+}
+
+// StartTyping notifies other participants that user is typing, repeated calls extend the timeout
+func (s *TypingService) StartTyping(ctx context.Context, userId, chatId int64) *types.StatusError {
+	res, err := s.Queries.CheckUserInChat(ctx, db.CheckUserInChatParams{UserID: userId, ConversationID: chatId})
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if res == 0 {
+		return &types.StatusError{Err: errors.New("user isn't exist in chat"), Status: http.StatusForbidden}
+	}
+	key := typingKey{userId, chatId}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.timers[key]
+	if ok && entry.timer.Stop() {
+		entry.timer.Reset(TypingTimeout)
+		return nil
+	}
+	// a running expiration waits for the lock and finds its entry replaced
+	s.timers[key] = s.newTypingEntry(key)
+	if ok {
+		return nil
+	}
+	s.Hub.Notify(realtime.Event{Type: realtime.TypingStarted, ConversationID: chatId,
+		Payload: realtime.TypingPayload{UserID: userId, TimeoutSeconds: int(TypingTimeout / time.Second)}}, userId)
+	return nil
+}
+
+func (s *TypingService) newTypingEntry(key typingKey) *typingEntry {
+	entry := &typingEntry{}
+	entry.timer = time.AfterFunc(TypingTimeout, func() { s.stop(key, entry) })
+	return entry
+}
+
+// StopTyping removes typing indicator before it expires
+func (s *TypingService) StopTyping(userId, chatId int64) {
+	s.stop(typingKey{userId, chatId}, nil)
+}
+
+// stop removes the indicator, expiration passes its entry and is ignored when the entry was replaced
+func (s *TypingService) stop(key typingKey, expired *typingEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.timers[key]
+	if !ok || expired != nil && entry != expired {
+		return
+	}
+	entry.timer.Stop()
+	delete(s.timers, key)
+	userId, chatId := key.userId, key.chatId
+	s.Hub.Notify(realtime.Event{Type: realtime.TypingStopped, ConversationID: chatId,
+		Payload: realtime.TypingPayload{UserID: userId}}, userId)
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"awesomeProject/db"
+	"awesomeProject/models"
+	"awesomeProject/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxUploadSize is the biggest file accepted through resumable uploads
+	MaxUploadSize = 2 << 30
+	// UploadExpiry is how long an upload session lives without receiving data,
+	// finished uploads are removed as well when they aren't attached to a message in time
+	UploadExpiry        = 24 * time.Hour
+	uploadCleanupBatch  = 100
+	uploadCleanupPeriod = 10 * time.Minute
+)
+
+// UploadService receives big files in chunks. Received bytes are appended to a partial file in PartialDir,
+// the finished file is moved to storage and can be attached to a message by the upload id
+type UploadService struct {
+	Queries    *db.Queries
+	Messages   *MessageService
+	PartialDir string
+	mu         sync.Mutex
+	// busy holds ids of sessions receiving a chunk, a session accepts one chunk at a time
+	busy map[string]bool
+}
+
+func NewUploadService(queries *db.Queries, messages *MessageService, partialDir string) *UploadService {
+	return &UploadService{Queries: queries, Messages: messages, PartialDir: partialDir, busy: map[string]bool{}}
+}
+
+// CreateUpload starts upload session of a file for the chat
+func (s *UploadService) CreateUpload(ctx context.Context, userId int64, request models.CreateUploadRequest) (*models.UploadSession, *types.StatusError) {
+	if request.Size > MaxUploadSize {
+		return nil, &types.StatusError{Err: errors.New("file is bigger than 2GB"), Status: http.StatusRequestEntityTooLarge}
+	}
+	if _, statErr := s.Messages.checkCanPost(ctx, request.ChatId, userId); statErr != nil {
+		return nil, statErr
+	}
+	name := filepath.Base(request.FileName)
+	if name == "." || name == string(filepath.Separator) {
+		return nil, &types.StatusError{Err: errors.New("incorrect file name"), Status: http.StatusBadRequest}
+	}
+	id, err := randomCode()
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if err = os.MkdirAll(s.PartialDir, 0o755); err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	file, err := os.OpenFile(s.partialPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	file.Close()
+	session, err := s.Queries.CreateUploadSession(ctx, db.CreateUploadSessionParams{ID: id, UserID: userId,
+		ConversationID: request.ChatId, FileName: name, Size: request.Size, ExpiresAt: time.Now().UTC().Add(UploadExpiry)})
+	if err != nil {
+		os.Remove(s.partialPath(id))
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	result := models.NewUploadSession(session)
+	return &result, nil
+}
+
+// GetUpload returns state of the upload, clients use offset to resume interrupted upload
+func (s *UploadService) GetUpload(ctx context.Context, userId int64, id string) (*models.UploadSession, *types.StatusError) {
+	session, statErr := s.getSession(ctx, userId, id)
+	if statErr != nil {
+		return nil, statErr
+	}
+	result := models.NewUploadSession(*session)
+	return &result, nil
+}
+
+// AppendChunk writes chunk at offset, which must be equal to the number of already received bytes.
+// Bytes received before the connection was broken are kept, so the client can continue from the new offset
+func (s *UploadService) AppendChunk(ctx context.Context, userId int64, id string, offset int64, chunk io.Reader) (*models.UploadSession, *types.StatusError) {
+	if !s.lock(id) {
+		return nil, &types.StatusError{Err: errors.New("upload is receiving another chunk"), Status: http.StatusConflict}
+	}
+	defer s.unlock(id)
+	session, statErr := s.getSession(ctx, userId, id)
+	if statErr != nil {
+		return nil, statErr
+	}
+	if session.StorageKey.Valid {
+		return nil, &types.StatusError{Err: errors.New("upload is already finished"), Status: http.StatusConflict}
+	}
+	if offset != session.UploadOffset {
+		return nil, &types.StatusError{Err: fmt.Errorf("upload offset is %d", session.UploadOffset), Status: http.StatusConflict}
+	}
+	file, err := os.OpenFile(s.partialPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	// drop bytes written after the last saved offset by a failed request
+	if err = file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	written, copyErr := io.Copy(file, io.LimitReader(chunk, session.Size-offset))
+	if err = file.Close(); err != nil && copyErr == nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	session.UploadOffset = offset + written
+	session.ExpiresAt = time.Now().UTC().Add(UploadExpiry)
+	if _, err = s.Queries.SetUploadOffset(context.WithoutCancel(ctx), db.SetUploadOffsetParams{UploadOffset: session.UploadOffset,
+		ExpiresAt: session.ExpiresAt, ID: id}); err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	if copyErr != nil {
+		return nil, &types.StatusError{Err: copyErr, Status: http.StatusBadRequest}
+	}
+	if session.UploadOffset == session.Size {
+		if statErr = s.finish(ctx, session); statErr != nil {
+			return nil, statErr
+		}
+	}
+	result := models.NewUploadSession(*session)
+	return &result, nil
+}
+
+// finish moves the received file to storage, uploads of unsupported types are removed
+func (s *UploadService) finish(ctx context.Context, session *db.UploadSession) *types.StatusError {
+	file, err := os.Open(s.partialPath(session.ID))
+	if err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	defer file.Close()
+	attachment, statErr := s.Messages.storeUpload(ctx, session.ConversationID, Upload{FileName: session.FileName,
+		Size: session.Size, File: file})
+	if statErr != nil {
+		if statErr.Status == http.StatusUnsupportedMediaType {
+			s.remove(ctx, *session)
+		}
+		return statErr
+	}
+	if _, err = s.Queries.CompleteUploadSession(ctx, db.CompleteUploadSessionParams{
+		StorageKey:  sql.NullString{String: attachment.StorageKey, Valid: true},
+		ContentType: sql.NullString{String: attachment.ContentType, Valid: true}, ID: session.ID}); err != nil {
+		s.Messages.deleteFiles(ctx, []string{attachment.StorageKey})
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	session.StorageKey = sql.NullString{String: attachment.StorageKey, Valid: true}
+	session.ContentType = sql.NullString{String: attachment.ContentType, Valid: true}
+	if err = os.Remove(s.partialPath(session.ID)); err != nil {
+		log.Printf("remove partial upload %s: %v", session.ID, err)
+	}
+	return nil
+}
+
+// CancelUpload removes the upload and its received data
+func (s *UploadService) CancelUpload(ctx context.Context, userId int64, id string) *types.StatusError {
+	if !s.lock(id) {
+		return &types.StatusError{Err: errors.New("upload is receiving a chunk"), Status: http.StatusConflict}
+	}
+	defer s.unlock(id)
+	session, statErr := s.getSession(ctx, userId, id)
+	if statErr != nil {
+		return statErr
+	}
+	if err := s.remove(ctx, *session); err != nil {
+		return &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// Run removes expired uploads until ctx is done
+func (s *UploadService) Run(ctx context.Context) {
+	ticker := time.NewTicker(uploadCleanupPeriod)
+	defer ticker.Stop()
+	for {
+		s.removeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *UploadService) removeExpired(ctx context.Context) {
+	for {
+		expired, err := s.Queries.GetExpiredUploadSessions(ctx, db.GetExpiredUploadSessionsParams{ExpiresAt: time.Now().UTC(),
+			Limit: uploadCleanupBatch})
+		if err != nil {
+			log.Printf("load expired uploads: %v", err)
+			return
+		}
+		for _, session := range expired {
+			if !s.lock(session.ID) {
+				continue
+			}
+			err = s.remove(ctx, session)
+			s.unlock(session.ID)
+			if err != nil {
+				log.Printf("remove expired upload %s: %v", session.ID, err)
+				return
+			}
+		}
+		if len(expired) < uploadCleanupBatch {
+			return
+		}
+	}
+}
+
+// remove deletes the session and then its files, files are kept when the session was already taken by a message
+func (s *UploadService) remove(ctx context.Context, session db.UploadSession) error {
+	rows, err := s.Queries.DeleteUploadSession(ctx, session.ID)
+	if err != nil || rows == 0 {
+		return err
+	}
+	s.removeFiles(ctx, session)
+	return nil
+}
+
+// removeFiles deletes the partial file and the stored file of the deleted session
+func (s *UploadService) removeFiles(ctx context.Context, session db.UploadSession) {
+	if err := os.Remove(s.partialPath(session.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("remove partial upload %s: %v", session.ID, err)
+	}
+	if session.StorageKey.Valid {
+		s.Messages.deleteFiles(ctx, []string{session.StorageKey.String})
+	}
+}
+
+// getSession returns live session of the user, sessions of other users are reported as missing
+func (s *UploadService) getSession(ctx context.Context, userId int64, id string) (*db.UploadSession, *types.StatusError) {
+	session, err := s.Queries.GetUploadSession(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && (session.UserID != userId || session.ExpiresAt.Before(time.Now())) {
+		return nil, &types.StatusError{Err: errors.New("upload not found"), Status: http.StatusNotFound}
+	}
+	if err != nil {
+		return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+	}
+	return &session, nil
+}
+
+func (s *UploadService) partialPath(id string) string {
+	return filepath.Join(s.PartialDir, id)
+}
+
+func (s *UploadService) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+func (s *UploadService) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.busy, id)
+}
+
+// uploadedAttachments turns finished uploads of the user into attachments of a new message in the chat
+func (s *MessageService) uploadedAttachments(ctx context.Context, userId, chatId int64, uploadIds []string) ([]db.CreateAttachmentParams, *types.StatusError) {
+	result := make([]db.CreateAttachmentParams, 0, len(uploadIds))
+	seen := map[string]bool{}
+	for _, id := range uploadIds {
+		if seen[id] {
+			return nil, &types.StatusError{Err: fmt.Errorf("upload %s is repeated", id), Status: http.StatusBadRequest}
+		}
+		seen[id] = true
+		session, err := s.Queries.GetUploadSession(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) || err == nil && session.UserID != userId {
+			return nil, &types.StatusError{Err: fmt.Errorf("upload %s not found", id), Status: http.StatusNotFound}
+		}
+		if err != nil {
+			return nil, &types.StatusError{Err: err, Status: http.StatusInternalServerError}
+		}
+		if session.ConversationID != chatId {
+			return nil, &types.StatusError{Err: fmt.Errorf("upload %s belongs to another chat", id), Status: http.StatusBadRequest}
+		}
+		if !session.StorageKey.Valid {
+			return nil, &types.StatusError{Err: fmt.Errorf("upload %s isn't finished", id), Status: http.StatusConflict}
+		}
+		thumbnailStatus := ThumbnailNone
+		if thumbnailTypes[session.ContentType.String] {
+			thumbnailStatus = ThumbnailPending
+		}
+		result = append(result, db.CreateAttachmentParams{StorageKey: session.StorageKey.String, FileName: session.FileName,
+			ContentType: session.ContentType.String, Size: session.Size, ThumbnailStatus: thumbnailStatus})
+	}
+	return result, nil
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"awesomeProject/models"
+	"awesomeProject/realtime"
+	"awesomeProject/storage"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestUploadService(t *testing.T) (*UploadService, *storage.Local) {
+	t.Helper()
+	database, queries := openTestDatabase(t)
+	files := storage.NewLocal(filepath.Join(t.TempDir(), "uploads"))
+	messages := NewMessageService(queries, database, nil, files, nil)
+	return NewUploadService(queries, messages, filepath.Join(t.TempDir(), "partial")), files
+}
+
+func readStored(t *testing.T, files storage.Storage, key string) string {
+	t.Helper()
+	r, err := files.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("open %s: %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAppendChunk(t *testing.T) {
+	type chunk struct {
+		offset     int64
+		data       string
+		wantStatus int
+	}
+	tests := []struct {
+		name         string
+		size         int64
+		chunks       []chunk
+		wantOffset   int64
+		wantFinished bool
+		wantContent  string
+	}{
+		{name: "one chunk", size: 11, chunks: []chunk{{offset: 0, data: "hello world"}},
+			wantOffset: 11, wantFinished: true, wantContent: "hello world"},
+		{name: "part of the file", size: 11, chunks: []chunk{{offset: 0, data: "hello"}}, wantOffset: 5},
+		{name: "resumed from offset", size: 11, chunks: []chunk{{offset: 0, data: "hello"}, {offset: 5, data: " world"}},
+			wantOffset: 11, wantFinished: true, wantContent: "hello world"},
+		{name: "offset ahead of received bytes", size: 11,
+			chunks: []chunk{{offset: 0, data: "hello"}, {offset: 7, data: "rld", wantStatus: http.StatusConflict}}, wantOffset: 5},
+		{name: "repeated chunk", size: 11,
+			chunks: []chunk{{offset: 0, data: "hello"}, {offset: 0, data: "hello", wantStatus: http.StatusConflict}}, wantOffset: 5},
+		{name: "bytes after size are dropped", size: 5, chunks: []chunk{{offset: 0, data: "hello world"}},
+			wantOffset: 5, wantFinished: true, wantContent: "hello"},
+		{name: "chunk after finish", size: 5,
+			chunks:     []chunk{{offset: 0, data: "hello"}, {offset: 5, data: "!", wantStatus: http.StatusConflict}},
+			wantOffset: 5, wantFinished: true, wantContent: "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, files := newTestUploadService(t)
+			ctx := context.Background()
+			session, statErr := s.CreateUpload(ctx, 3, models.CreateUploadRequest{ChatId: 1, FileName: "a.txt", Size: tt.size})
+			if statErr != nil {
+				t.Fatal(statErr)
+			}
+			for _, c := range tt.chunks {
+				_, statErr = s.AppendChunk(ctx, 3, session.ID, c.offset, strings.NewReader(c.data))
+				if status := statusOf(statErr); status != c.wantStatus {
+					t.Fatalf("append %q at %d: got status %d (%v), want %d", c.data, c.offset, status, statErr, c.wantStatus)
+				}
+			}
+			got, statErr := s.GetUpload(ctx, 3, session.ID)
+			if statErr != nil {
+				t.Fatal(statErr)
+			}
+			if got.Offset != tt.wantOffset || got.Finished != tt.wantFinished {
+				t.Fatalf("got offset %d finished %t, want %d %t", got.Offset, got.Finished, tt.wantOffset, tt.wantFinished)
+			}
+			_, err := os.Stat(s.partialPath(session.ID))
+			if tt.wantFinished != errors.Is(err, os.ErrNotExist) {
+				t.Errorf("partial file exists: %v", err)
+			}
+			if !tt.wantFinished {
+				return
+			}
+			row, err := s.Queries.GetUploadSession(ctx, session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content := readStored(t, files, row.StorageKey.String); content != tt.wantContent {
+				t.Errorf("stored %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestAppendChunkRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		userId     int64
+		data       string
+		wantStatus int
+		wantGone   bool
+	}{
+		{name: "upload of another user", userId: 1, data: "hello", wantStatus: http.StatusNotFound},
+		{name: "unsupported type", userId: 3, data: "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+			wantStatus: http.StatusUnsupportedMediaType, wantGone: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestUploadService(t)
+			ctx := context.Background()
+			session, statErr := s.CreateUpload(ctx, 3, models.CreateUploadRequest{ChatId: 1, FileName: "a.bin",
+				Size: int64(len(tt.data))})
+			if statErr != nil {
+				t.Fatal(statErr)
+			}
+			_, statErr = s.AppendChunk(ctx, tt.userId, session.ID, 0, strings.NewReader(tt.data))
+			if status := statusOf(statErr); status != tt.wantStatus {
+				t.Fatalf("got status %d (%v), want %d", status, statErr, tt.wantStatus)
+			}
+			_, statErr = s.GetUpload(ctx, 3, session.ID)
+			if gone := statusOf(statErr) == http.StatusNotFound; gone != tt.wantGone {
+				t.Errorf("upload removed %t, want %t", gone, tt.wantGone)
+			}
+		})
+	}
+}
+
+func TestCreateUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		userId     int64
+		request    models.CreateUploadRequest
+		wantStatus int
+	}{
+		{name: "member", userId: 3, request: models.CreateUploadRequest{ChatId: 1, FileName: "dir/a.txt", Size: 1}},
+		{name: "too big", userId: 3, request: models.CreateUploadRequest{ChatId: 1, FileName: "a.txt", Size: MaxUploadSize + 1},
+			wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "reader", userId: 4, request: models.CreateUploadRequest{ChatId: 1, FileName: "a.txt", Size: 1},
+			wantStatus: http.StatusForbidden},
+		{name: "member of channel", userId: 3, request: models.CreateUploadRequest{ChatId: 2, FileName: "a.txt", Size: 1},
+			wantStatus: http.StatusForbidden},
+		{name: "missing chat", userId: 3, request: models.CreateUploadRequest{ChatId: 100, FileName: "a.txt", Size: 1},
+			wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestUploadService(t)
+			session, statErr := s.CreateUpload(context.Background(), tt.userId, tt.request)
+			if status := statusOf(statErr); status != tt.wantStatus {
+				t.Fatalf("got status %d (%v), want %d", status, statErr, tt.wantStatus)
+			}
+			if statErr == nil && session.FileName != "a.txt" {
+				t.Errorf("file name %q, want a.txt", session.FileName)
+			}
+		})
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	s, files := newTestUploadService(t)
+	ctx := context.Background()
+	create := func(data string) *models.UploadSession {
+		session, statErr := s.CreateUpload(ctx, 3, models.CreateUploadRequest{ChatId: 1, FileName: "a.txt", Size: 11})
+		if statErr != nil {
+			t.Fatal(statErr)
+		}
+		if _, statErr = s.AppendChunk(ctx, 3, session.ID, 0, strings.NewReader(data)); statErr != nil {
+			t.Fatal(statErr)
+		}
+		return session
+	}
+	partial := create("hello")
+	finished := create("hello world")
+	live := create("hello")
+	stored, err := s.Queries.GetUploadSession(ctx, finished.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().UTC().Add(-time.Minute)
+	for _, id := range []string{partial.ID, finished.ID} {
+		if _, err = s.Messages.Database.ExecContext(ctx, "UPDATE upload_sessions SET expires_at = ? WHERE id = ?", expired, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, statErr := s.GetUpload(ctx, 3, partial.ID); statusOf(statErr) != http.StatusNotFound {
+		t.Errorf("expired upload is returned: %v", statErr)
+	}
+	if _, statErr := s.AppendChunk(ctx, 3, partial.ID, 5, strings.NewReader(" world")); statusOf(statErr) != http.StatusNotFound {
+		t.Errorf("expired upload accepts chunks: %v", statErr)
+	}
+
+	s.removeExpired(ctx)
+	tests := []struct {
+		id       string
+		wantGone bool
+	}{
+		{id: partial.ID, wantGone: true},
+		{id: finished.ID, wantGone: true},
+		{id: live.ID},
+	}
+	for _, tt := range tests {
+		_, err = s.Queries.GetUploadSession(ctx, tt.id)
+		if gone := err != nil; gone != tt.wantGone {
+			t.Errorf("upload %s removed %t, want %t", tt.id, gone, tt.wantGone)
+		}
+		_, err = os.Stat(s.partialPath(tt.id))
+		if gone := errors.Is(err, os.ErrNotExist); gone != tt.wantGone {
+			t.Errorf("partial file of %s removed %t, want %t", tt.id, gone, tt.wantGone)
+		}
+	}
+	if _, err = files.Open(ctx, stored.StorageKey.String); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("stored file of expired upload: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteConversationUploads(t *testing.T) {
+	s, files := newTestUploadService(t)
+	ctx := context.Background()
+	conversations := NewConversationService(s.Queries, s.Messages.Database, realtime.NewHub(), nil, files, s)
+	var sessions []*models.UploadSession
+	for _, data := range []string{"hello", "hello world"} {
+		session, statErr := s.CreateUpload(ctx, 3, models.CreateUploadRequest{ChatId: 1, FileName: "a.txt", Size: 11})
+		if statErr != nil {
+			t.Fatal(statErr)
+		}
+		if _, statErr = s.AppendChunk(ctx, 3, session.ID, 0, strings.NewReader(data)); statErr != nil {
+			t.Fatal(statErr)
+		}
+		sessions = append(sessions, session)
+	}
+	stored, err := s.Queries.GetUploadSession(ctx, sessions[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statErr := conversations.deleteConversation(ctx, 1, 1); statErr != nil {
+		t.Fatal(statErr)
+	}
+	for _, session := range sessions {
+		if _, err = os.Stat(s.partialPath(session.ID)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("partial file of %s: %v", session.ID, err)
+		}
+	}
+	if _, err = files.Open(ctx, stored.StorageKey.String); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("stored file of upload in deleted chat: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"awesomeProject/types"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultPresignExpiry is used when S3_PRESIGN_EXPIRY isn't set
+const DefaultPresignExpiry = 15 * time.Minute
+
+// FromEnv creates storage of the driver, "local" or empty keeps files in types.UploadsDir,
+// "s3" connects to the bucket described by S3_ENDPOINT, S3_ACCESS_KEY, S3_SECRET_KEY, S3_BUCKET,
+// S3_REGION, S3_USE_SSL and S3_PRESIGN_EXPIRY environment variables
+func FromEnv(ctx context.Context, driver string) (Storage, error) {
+	switch driver {
+	case "", "local":
+		return NewLocal(types.UploadsDir), nil
+	case "s3":
+		config := S3Config{
+			Endpoint:      os.Getenv("S3_ENDPOINT"),
+			AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:     os.Getenv("S3_SECRET_KEY"),
+			Bucket:        os.Getenv("S3_BUCKET"),
+			Region:        os.Getenv("S3_REGION"),
+			PresignExpiry: DefaultPresignExpiry,
+		}
+		if config.Endpoint == "" || config.Bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required by s3 storage")
+		}
+		var err error
+		if value := os.Getenv("S3_USE_SSL"); value != "" {
+			if config.UseSSL, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("S3_USE_SSL: %w", err)
+			}
+		}
+		if value := os.Getenv("S3_PRESIGN_EXPIRY"); value != "" {
+			if config.PresignExpiry, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("S3_PRESIGN_EXPIRY: %w", err)
+			}
+		}
+		return NewS3(ctx, config)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "uploads")
+	local := NewLocal(root)
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "attachments/1/a.png", want: filepath.Join(root, "attachments", "1", "a.png")},
+		{key: "avatars/chat_1_x.png", want: filepath.Join(root, "avatars", "chat_1_x.png")},
+		{key: "attachments/../avatars/a.png", want: filepath.Join(root, "avatars", "a.png")},
+		{key: "", wantErr: true},
+		{key: "../a.png", wantErr: true},
+		{key: "attachments/../../a.png", wantErr: true},
+		{key: "/etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := local.path(tt.key)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("path(%q) = %q, want error", tt.key, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("path(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalRejectsUnsafeKeys(t *testing.T) {
+	dir := t.TempDir()
+	local := NewLocal(filepath.Join(dir, "uploads"))
+	ctx := context.Background()
+	key := "../outside.txt"
+	if err := local.Put(ctx, key, strings.NewReader("data")); err == nil {
+		t.Error("put accepted unsafe key")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file written outside of root: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "outside.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := local.Open(ctx, key); err == nil {
+		r.Close()
+		t.Error("open accepted unsafe key")
+	}
+	if err := local.Delete(ctx, key); err == nil {
+		t.Error("delete accepted unsafe key")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside.txt")); err != nil {
+		t.Errorf("file outside of root is gone: %v", err)
+	}
+}
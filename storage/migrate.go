@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Migrate copies every file of src to dst under the same key and returns the number of copied files.
+// With removeSource files are deleted from src after they are copied, so running it again continues the move
+func Migrate(ctx context.Context, src, dst Storage, removeSource bool) (int, error) {
+	// keys are collected first, storages aren't required to support changes while they are walked
+	var keys []string
+	if err := src.Walk(ctx, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("list files: %w", err)
+	}
+	for i, key := range keys {
+		if err := copyFile(ctx, src, dst, key); err != nil {
+			return i, fmt.Errorf("copy %s: %w", key, err)
+		}
+		if removeSource {
+			if err := src.Delete(ctx, key); err != nil {
+				return i + 1, fmt.Errorf("delete %s: %w", key, err)
+			}
+		}
+	}
+	return len(keys), nil
+}
+
+func copyFile(ctx context.Context, src, dst Storage, key string) error {
+	r, err := src.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return dst.Put(ctx, key, r)
+}
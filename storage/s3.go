@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"time"
+)
+
+// s3PartSize is the buffer of multipart uploads, files of unknown size up to 10000 parts are accepted
+const s3PartSize = 16 << 20
+
+// S3Config describes a bucket of an S3 compatible service like AWS S3 or MinIO
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+	// PresignExpiry is how long download links given to clients are valid
+	PresignExpiry time.Duration
+}
+
+// S3 stores files as objects of one bucket, the bucket is created when missing
+type S3 struct {
+	Client        *minio.Client
+	Bucket        string
+	PresignExpiry time.Duration
+}
+
+func NewS3(ctx context.Context, config S3Config) (*S3, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		if err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("create bucket %s: %w", config.Bucket, err)
+		}
+	}
+	return &S3{Client: client, Bucket: config.Bucket, PresignExpiry: config.PresignExpiry}, nil
+}
+
+// Put sends files smaller than a part in one request when size of the reader is known
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.Client.PutObject(ctx, s.Bucket, key, r, readerSize(r), minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+// readerSize returns the number of bytes left in seekable readers and -1 for others
+func readerSize(r io.Reader) int64 {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err = seeker.Seek(current, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - current
+}
+
+// Open checks that the object exists, the content is streamed while it is read
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.Client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+// Delete removes the object, deleting a missing object is not an error
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) Walk(ctx context.Context, fn func(key string) error) error {
+	for object := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err := fn(object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PresignGet returns a link to download the object without credentials, it expires after PresignExpiry
+func (s *S3) PresignGet(ctx context.Context, key, disposition, fileName, contentType string) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	link, err := s.Client.PresignedGetObject(ctx, s.Bucket, key, s.PresignExpiry, params)
+	if err != nil {
+		return "", err
+	}
+	return link.String(), nil
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestS3 connects to the service of S3_ENDPOINT, S3_ACCESS_KEY, S3_SECRET_KEY and S3_USE_SSL like a local MinIO.
+// Every test gets its own bucket which is emptied and removed afterwards
+func newTestS3(t *testing.T) *S3 {
+	t.Helper()
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_ENDPOINT is not set")
+	}
+	config := S3Config{
+		Endpoint:      endpoint,
+		AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+		SecretKey:     os.Getenv("S3_SECRET_KEY"),
+		Bucket:        fmt.Sprintf("storage-test-%d", time.Now().UnixNano()),
+		Region:        os.Getenv("S3_REGION"),
+		PresignExpiry: time.Minute,
+	}
+	if value := os.Getenv("S3_USE_SSL"); value != "" {
+		var err error
+		if config.UseSSL, err = strconv.ParseBool(value); err != nil {
+			t.Fatalf("S3_USE_SSL: %v", err)
+		}
+	}
+	s, err := NewS3(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for _, key := range walkKeys(t, s) {
+			if err := s.Delete(ctx, key); err != nil {
+				t.Errorf("delete %s: %v", key, err)
+			}
+		}
+		if err := s.Client.RemoveBucket(ctx, s.Bucket); err != nil {
+			t.Errorf("remove bucket: %v", err)
+		}
+	})
+	return s
+}
+
+func walkKeys(t *testing.T, s Storage) []string {
+	t.Helper()
+	var keys []string
+	if err := s.Walk(context.Background(), func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func readKey(t *testing.T, s Storage, key string) string {
+	t.Helper()
+	r, err := s.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("open %s: %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestS3(t *testing.T) {
+	s := newTestS3(t)
+	ctx := context.Background()
+	files := map[string]string{
+		"attachments/1/a.txt": "first",
+		"attachments/2/b.png": "second",
+		"avatars/chat_1.png":  "",
+	}
+	for key, content := range files {
+		if err := s.Put(ctx, key, strings.NewReader(content)); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	for key, content := range files {
+		if got := readKey(t, s, key); got != content {
+			t.Errorf("content of %s = %q, want %q", key, got, content)
+		}
+	}
+	if _, err := s.Open(ctx, "attachments/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("open missing key: got %v, want ErrNotFound", err)
+	}
+	want := []string{"attachments/1/a.txt", "attachments/2/b.png", "avatars/chat_1.png"}
+	if got := walkKeys(t, s); !slices.Equal(got, want) {
+		t.Errorf("walk = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		disposition string
+		contentType string
+	}{
+		{disposition: "attachment", contentType: "text/plain"},
+		{disposition: "inline", contentType: "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run("presign "+tt.disposition, func(t *testing.T) {
+			link, err := s.PresignGet(ctx, "attachments/1/a.txt", tt.disposition, "a b.txt", tt.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Get(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK || string(body) != "first" {
+				t.Fatalf("get presigned link: %d %q", resp.StatusCode, body)
+			}
+			if got, want := resp.Header.Get("Content-Disposition"), tt.disposition+`; filename="a b.txt"`; got != want {
+				t.Errorf("Content-Disposition = %q, want %q", got, want)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+		})
+	}
+
+	if err := s.Delete(ctx, "attachments/1/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "attachments/1/a.txt"); err != nil {
+		t.Errorf("delete missing key: %v", err)
+	}
+	if _, err := s.Open(ctx, "attachments/1/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("open deleted key: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.Client.StatObject(ctx, s.Bucket, "attachments/1/a.txt", minio.StatObjectOptions{}); err == nil {
+		t.Error("deleted object still exists")
+	}
+}
+
+func TestMigrateToS3(t *testing.T) {
+	s := newTestS3(t)
+	ctx := context.Background()
+	local := NewLocal(t.TempDir())
+	files := map[string]string{
+		"attachments/1/a.txt":       "first",
+		"attachments/1/a_thumb.jpg": "thumbnail",
+		"avatars/chat_1.png":        string(bytes.Repeat([]byte{1, 2, 3}, 1000)),
+	}
+	for key, content := range files {
+		if err := local.Put(ctx, key, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := Migrate(ctx, local, s, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(files) {
+		t.Errorf("migrated %d files, want %d", count, len(files))
+	}
+	for key, content := range files {
+		if got := readKey(t, s, key); got != content {
+			t.Errorf("content of %s = %q, want %q", key, got, content)
+		}
+	}
+	if keys := walkKeys(t, local); len(keys) != 0 {
+		t.Errorf("source still has %v", keys)
+	}
+
+	back := NewLocal(t.TempDir())
+	if count, err = Migrate(ctx, s, back, false); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(files) {
+		t.Errorf("migrated back %d files, want %d", count, len(files))
+	}
+	for key, content := range files {
+		if got := readKey(t, back, key); got != content {
+			t.Errorf("content of %s = %q, want %q", key, got, content)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Open when nothing is stored under the key
+var ErrNotFound = errors.New("file not found")
+
+// Storage keeps uploaded files under slash separated keys like "attachments/1/abc.png"
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn with every stored key, it is used to move files between storages
+	Walk(ctx context.Context, fn func(key string) error) error
+}
+
+// Presigner is implemented by storages able to give clients a temporary link to download a file directly,
+// disposition ("attachment" or "inline"), fileName and contentType are sent back by the storage in the download response
+type Presigner interface {
+	PresignGet(ctx context.Context, key, disposition, fileName, contentType string) (string, error)
+}
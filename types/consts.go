@@ -7,3 +7,9 @@ const UserContext = contextString("user")
 var SecretKey []byte
 
 const EmailConfirmationUrl = "http://localhost:5000/auth/email_confirmation"
+
+// UploadsDir is where uploaded files are stored
+const UploadsDir = "uploads"
+
+// PartialUploadsDir keeps files of unfinished resumable uploads
+const PartialUploadsDir = "uploads_partial"